@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"users-books-api-testing/lib/logging"
+
+	"gorm.io/gorm"
+)
+
+// Driver plugs a database into the app.
+type Driver struct {
+	// Open turns the part of a DSN after "<name>://" into a GORM dialector.
+	Open func(dsn string) gorm.Dialector
+	// IsDuplicateKey reports whether err is the driver's unique constraint
+	// violation.
+	IsDuplicateKey func(err error) bool
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// RegisterDriver makes a database driver available under the given DSN
+// scheme. It panics if the name is registered twice.
+func RegisterDriver(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver.Open == nil {
+		panic("config: RegisterDriver driver has no Open")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("config: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers returns the sorted names of the registered drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open connects to the database described by dsn, which must be of the form
+// "<driver>://<driver specific dsn>".
+func Open(dsn string) (*gorm.DB, error) {
+	name, rest, err := splitDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("config: unknown database driver %q (registered: %s)", name, strings.Join(Drivers(), ", "))
+	}
+
+	return gorm.Open(driver.Open(rest), &gorm.Config{Logger: logging.Gorm{}})
+}
+
+// IsDuplicateKey reports whether err is a unique constraint violation from
+// any of the registered drivers.
+func IsDuplicateKey(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	for _, driver := range drivers {
+		if driver.IsDuplicateKey != nil && driver.IsDuplicateKey(err) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSQLite(dsn string) bool {
+	name, _, err := splitDSN(dsn)
+	return err == nil && name == "sqlite"
+}
+
+func splitDSN(dsn string) (string, string, error) {
+	i := strings.Index(dsn, "://")
+	if i <= 0 {
+		return "", "", fmt.Errorf("config: DSN %q has no driver scheme", dsn)
+	}
+	return dsn[:i], dsn[i+len("://"):], nil
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"errors"
+
+	driver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// ER_DUP_ENTRY
+const mysqlDuplicateEntry = 1062
+
+func init() {
+	RegisterDriver("mysql", Driver{
+		Open: func(dsn string) gorm.Dialector {
+			return mysql.Open(dsn)
+		},
+		IsDuplicateKey: func(err error) bool {
+			var mysqlErr *driver.MySQLError
+			return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+		},
+	})
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterDriver("sqlite", Driver{
+		Open: func(dsn string) gorm.Dialector {
+			return sqlite.Open(dsn)
+		},
+		IsDuplicateKey: func(err error) bool {
+			var sqliteErr sqlite3.Error
+			return errors.As(err, &sqliteErr) &&
+				(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+					sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+		},
+	})
+}
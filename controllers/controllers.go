@@ -1,169 +1,905 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"users-books-api-testing/config"
+	"users-books-api-testing/dto"
+	"users-books-api-testing/lib/apierror"
 	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/validation"
+	"users-books-api-testing/middlewares"
 	"users-books-api-testing/models"
 
 	"github.com/labstack/echo/v4"
 )
 
+func init() {
+	apierror.Register(database.ErrNotFound, http.StatusNotFound)
+	apierror.Register(database.ErrConflict, http.StatusConflict)
+	apierror.Register(database.ErrInvalidCredentials, http.StatusUnauthorized)
+	apierror.Register(database.ErrInvalidRefreshToken, http.StatusUnauthorized)
+	apierror.Register(database.ErrInvalidListOptions, http.StatusBadRequest)
+	apierror.Register(database.ErrStaleVersion, http.StatusPreconditionFailed)
+	apierror.Register(database.ErrSearchUnavailable, http.StatusServiceUnavailable)
+	apierror.Register(database.ErrUnknownAuthor, http.StatusUnprocessableEntity)
+}
+
+// Controller serves the HTTP handlers on top of the repositories in store.
+type Controller struct {
+	store  *database.Store
+	logins *loginThrottle
+}
+
+func New(store *database.Store) *Controller {
+	return &Controller{store: store, logins: newLoginThrottle(config.LOGIN_THROTTLE, time.Now)}
+}
+
 // USERS CONTROLLERS
-func CreateUserController(c echo.Context) error {
-	var user models.Users
-	c.Bind(&user)
+func (ctl *Controller) CreateUserController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req dto.CreateUserRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
 
-	if e := database.CreateUser(&user); e != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, e)
+	// the request has no role, so everyone signs up as a member; admins are
+	// made with the migrate promote command, or by other admins
+	user := req.Model()
+	if e := ctl.store.Users.CreateUser(ctx, &user); e != nil {
+		return e
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success create new user",
-		"user":    user,
+		"user":    dto.NewUser(user),
 	})
 }
 
-func GetUsersController(c echo.Context) error {
-	users, e := database.GetUsers()
+func (ctl *Controller) GetUsersController(c echo.Context) error {
+	ctx := c.Request().Context()
+	opts, e := listOptions(c)
+	if e != nil {
+		return e
+	}
+	filter := database.UserFilter{
+		Name: c.QueryParam("name"),
+		Role: c.QueryParam("role"),
+	}
+	if filter.IncludeDeleted, e = includeDeleted(c); e != nil {
+		return e
+	}
 
+	users, page, e := ctl.store.Users.GetUsers(ctx, filter, opts)
 	if e != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, e)
+		return e
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success",
-		"users":  users,
+		"users":   dto.NewUsers(users),
+		"page":    pageLinks(c, opts, page),
 	})
 }
 
-func GetUserByIdController(c echo.Context) error {
+func (ctl *Controller) GetUserByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	user, e := database.GetUserById(id)
+	user, e := ctl.store.Users.GetUserById(ctx, id)
 
 	if e != nil {
-		return c.JSON(http.StatusNotFound, map[string]interface{}{
-			"message": "record not found",
-		})
+		return e
 	}
+	setETag(c, user.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success",
-		"user":   user,
+		"user":    dto.NewUser(user),
 	})
 }
 
-func UpdateUserByIdController(c echo.Context) error {
-	var user models.Users
-	c.Bind(&user)
+func (ctl *Controller) UpdateUserByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req dto.UpdateUserRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	current, e := ctl.store.Users.GetUserById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if e := ifMatch(c, current.Version); e != nil {
+		return e
+	}
+	if req.Role != "" && req.Role != current.Role && !isAdmin(c) {
+		return apierror.New(http.StatusForbidden, "only an admin can change roles")
+	}
+
+	user := req.Apply(current)
+	return ctl.updateUser(c, id, &user)
+}
+
+// PatchUserByIdController applies a JSON Merge Patch to a user.
+func (ctl *Controller) PatchUserByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	patch, e := readPatch(c)
+	if e != nil {
+		return e
+	}
 
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	if e := database.UpdateUserById(id, &user); e != nil {
-		return echo.NewHTTPError(http.StatusNotFound, map[string]interface{}{
-			"message": "record not found",
-		})
+	current, e := ctl.store.Users.GetUserById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if e := ifMatch(c, current.Version); e != nil {
+		return e
+	}
+
+	req := dto.NewPatchUserRequest(current)
+	if e := applyPatch(patch, &req); e != nil {
+		return e
 	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+	if req.Role != current.Role && !isAdmin(c) {
+		return apierror.New(http.StatusForbidden, "only an admin can change roles")
+	}
+
+	user := req.Apply(current)
+	return ctl.updateUser(c, id, &user)
+}
+
+// updateUser stores user and answers with the result.
+func (ctl *Controller) updateUser(c echo.Context, id int, user *models.Users) error {
+	ctx := c.Request().Context()
+	if e := ctl.store.Users.UpdateUserById(ctx, id, user); e != nil {
+		return e
+	}
+	updated, e := ctl.store.Users.GetUserById(ctx, id)
+	if e != nil {
+		return e
+	}
+	setETag(c, updated.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success update user",
-		"user":   user,
+		"user":    dto.NewUser(updated),
 	})
 }
 
-func DeleteUserByIdController(c echo.Context) error {
+func (ctl *Controller) DeleteUserByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	if err := database.DeleteUserById(id); err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, map[string]interface{}{
-			"message": "record not found",
-		})
+	if e := ctl.store.Users.DeleteUserById(ctx, id); e != nil {
+		return e
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success delete user",
 	})
 }
 
-func LoginUserController(c echo.Context) error {
-	user := models.Users{}
-	c.Bind(&user)
+// RestoreUserController undoes the deletion of a user.
+func (ctl *Controller) RestoreUserController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if e := ctl.store.Users.RestoreUserById(ctx, id); e != nil {
+		return e
+	}
+	user, e := ctl.store.Users.GetUserById(ctx, id)
+	if e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success restore user",
+		"user":    dto.NewUser(user),
+	})
+}
+
+// UnlockUserController lifts the login lockout on a user's account.
+func (ctl *Controller) UnlockUserController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	user, e := ctl.store.Users.GetUserById(ctx, id)
+	if e != nil {
+		return e
+	}
+	ctl.logins.unlock(user.Email)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success unlock user",
+	})
+}
+
+func (ctl *Controller) LoginUserController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req dto.LoginRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+	user := req.Model()
+
+	email := database.NormalizeEmail(user.Email)
+	if e := ctl.logins.allow(c, email); e != nil {
+		return e
+	}
+
+	found, e := ctl.store.Users.LoginUser(ctx, &user)
+	if errors.Is(e, database.ErrInvalidCredentials) {
+		ctl.logins.failed(ctx, email, c.RealIP())
+	}
+	if e != nil {
+		return e
+	}
+	ctl.logins.succeeded(email)
+
+	refreshToken, e := ctl.store.Tokens.CreateRefreshToken(ctx, found.ID)
+	if e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "success login",
+		"user":          dto.NewUser(found),
+		"access_token":  found.Token,
+		"refresh_token": refreshToken,
+	})
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+func (ctl *Controller) RefreshTokenController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req refreshTokenRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+
+	userId, refreshToken, e := ctl.store.Tokens.RotateRefreshToken(ctx, req.RefreshToken)
+	if e != nil {
+		return e
+	}
+
+	user, e := ctl.store.Users.RefreshUserToken(ctx, int(userId))
+	if errors.Is(e, database.ErrNotFound) {
+		// the account is gone, so the token it was issued for is useless too
+		return database.ErrInvalidRefreshToken
+	}
+	if e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "success refresh token",
+		"user":          dto.NewUser(user),
+		"access_token":  user.Token,
+		"refresh_token": refreshToken,
+	})
+}
+
+// LogoutController revokes the access token used for the request. The
+// refresh token in the body is revoked if given, otherwise every refresh
+// token of the user is, which logs them out on all devices.
+func (ctl *Controller) LogoutController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req refreshTokenRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+
+	jti, exp := middlewares.ExtractTokenID(c)
+	if e := ctl.store.Tokens.RevokeAccessToken(ctx, jti, exp); e != nil {
+		return e
+	}
 
-	users, e := database.LoginUser(&user)
+	var e error
+	if req.RefreshToken != "" {
+		e = ctl.store.Tokens.RevokeRefreshToken(ctx, req.RefreshToken)
+	} else {
+		e = ctl.store.Tokens.RevokeUserRefreshTokens(ctx, uint(middlewares.ExtractTokenUserId(c)))
+	}
 	if e != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, e.Error())
+		return e
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "success login",
-		"user": users,
+		"message": "success logout",
 	})
 }
 
 
 // BOOKS CONTROLLERS
-func AddBookController(c echo.Context) error {
-	var book models.Books
-	c.Bind(&book)
+func (ctl *Controller) AddBookController(c echo.Context) error {
+	ctx := c.Request().Context()
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
+	}
+	var req dto.CreateBookRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+	book := req.Model()
+	book.UserID = uint(middlewares.ExtractTokenUserId(c))
 
-	if e := database.AddBook(&book); e != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, e)
+	if e := ctl.store.Books.AddBook(ctx, &book); e != nil {
+		return e
+	}
+	view := dto.NewBook(book)
+	if e := ctl.withAuthors(ctx, expand, &view); e != nil {
+		return e
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success add new book",
-		"book":    book,
+		"book":    view,
 	})
 }
 
-func GetBooksController(c echo.Context) error {
-	books, e := database.GetBooks()
+func (ctl *Controller) GetBooksController(c echo.Context) error {
+	ctx := c.Request().Context()
+	opts, e := listOptions(c)
+	if e != nil {
+		return e
+	}
+	filter := database.BookFilter{
+		Author: c.QueryParam("author"),
+		Title:  c.QueryParam("title"),
+	}
+	if filter.IncludeDeleted, e = includeDeleted(c); e != nil {
+		return e
+	}
+	authorID, e := intQueryParam(c, "author_id")
+	if e != nil {
+		return e
+	}
+	filter.AuthorID = uint(authorID)
+	if filter.YearFrom, e = intQueryParam(c, "year_from"); e != nil {
+		return e
+	}
+	if filter.YearTo, e = intQueryParam(c, "year_to"); e != nil {
+		return e
+	}
+
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
+	}
 
+	books, page, e := ctl.store.Books.GetBooks(ctx, filter, opts)
 	if e != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, e)
+		return e
+	}
+	views, e := ctl.bookViews(ctx, expand, dto.NewBooks(books))
+	if e != nil {
+		return e
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success",
-		"books":  books,
+		"books":   views,
+		"page":    pageLinks(c, opts, page),
 	})
 }
 
-func GetBookByIdController(c echo.Context) error {
+// SearchBooksController finds books by the words of their title and author.
+func (ctl *Controller) SearchBooksController(c echo.Context) error {
+	ctx := c.Request().Context()
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return apierror.New(http.StatusBadRequest, "q is required")
+	}
+	limit, e := intQueryParam(c, "limit")
+	if e != nil {
+		return e
+	}
+	offset, e := intQueryParam(c, "offset")
+	if e != nil {
+		return e
+	}
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
+	}
+
+	hits, total, e := ctl.store.SearchBooks(ctx, query, limit, offset)
+	if e != nil {
+		return e
+	}
+	results := dto.NewBookSearchResults(hits)
+	books := make([]*dto.Book, len(results))
+	for i := range results {
+		books[i] = &results[i].Book
+	}
+	if e := ctl.withAuthors(ctx, expand, books...); e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"results": results,
+		"total":   total,
+	})
+}
+
+func (ctl *Controller) GetBookByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
 	id, _ := strconv.Atoi(c.Param("id"))
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
+	}
 
-	book, e := database.GetBookById(id)
+	book, e := ctl.store.Books.GetBookById(ctx, id)
 
 	if e != nil {
-		return c.JSON(http.StatusNotFound, map[string]interface{}{
-			"message": "record not found",
-		})
+		return e
+	}
+	view := dto.NewBook(book)
+	if e := ctl.withAuthors(ctx, expand, &view); e != nil {
+		return e
 	}
+	setETag(c, book.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success",
-		"book":   book,
+		"book":    view,
 	})
 }
 
-func UpdateBookByIdController(c echo.Context) error {
-	var book models.Books
-	c.Bind(&book)
+func (ctl *Controller) UpdateBookByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
+	}
+	var req dto.UpdateBookRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
 
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	if e := database.UpdateBookById(id, &book); e != nil {
-		return echo.NewHTTPError(http.StatusNotFound, map[string]interface{}{
-			"message": "record not found",
-		})
+	current, e := ctl.store.Books.GetBookById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if !canModifyBook(c, current) {
+		return apierror.New(http.StatusForbidden, "only the owner or an admin can modify this book")
+	}
+	if e := ifMatch(c, current.Version); e != nil {
+		return e
+	}
+
+	book := req.Apply(current)
+	return ctl.updateBook(c, id, &book, expand)
+}
+
+// PatchBookByIdController applies a JSON Merge Patch to a book.
+func (ctl *Controller) PatchBookByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
 	}
+	patch, e := readPatch(c)
+	if e != nil {
+		return e
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	current, e := ctl.store.Books.GetBookById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if !canModifyBook(c, current) {
+		return apierror.New(http.StatusForbidden, "only the owner or an admin can modify this book")
+	}
+	if e := ifMatch(c, current.Version); e != nil {
+		return e
+	}
+
+	req := dto.NewPatchBookRequest(current)
+	if e := applyPatch(patch, &req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+
+	book := req.Apply(current)
+	return ctl.updateBook(c, id, &book, expand)
+}
+
+// updateBook stores book and answers with the result.
+func (ctl *Controller) updateBook(c echo.Context, id int, book *models.Books, expand bool) error {
+	ctx := c.Request().Context()
+	if e := ctl.store.Books.UpdateBookById(ctx, id, book); e != nil {
+		return e
+	}
+	updated, e := ctl.store.Books.GetBookById(ctx, id)
+	if e != nil {
+		return e
+	}
+	view := dto.NewBook(updated)
+	if e := ctl.withAuthors(ctx, expand, &view); e != nil {
+		return e
+	}
+	setETag(c, updated.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success update book",
-		"book":   book,
+		"book":    view,
 	})
 }
 
-func DeleteBookByIdController(c echo.Context) error {
+func (ctl *Controller) DeleteBookByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	if err := database.DeleteBookById(id); err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, map[string]interface{}{
-			"message": "record not found",
-		})
+	current, e := ctl.store.Books.GetBookById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if !canModifyBook(c, current) {
+		return apierror.New(http.StatusForbidden, "only the owner or an admin can delete this book")
+	}
+
+	if e := ctl.store.Books.DeleteBookById(ctx, id); e != nil {
+		return e
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success delete book",
 	})
 }
+
+// RestoreBookController undoes the deletion of a book.
+func (ctl *Controller) RestoreBookController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
+	}
+
+	if e := ctl.store.Books.RestoreBookById(ctx, id); e != nil {
+		return e
+	}
+	book, e := ctl.store.Books.GetBookById(ctx, id)
+	if e != nil {
+		return e
+	}
+	view := dto.NewBook(book)
+	if e := ctl.withAuthors(ctx, expand, &view); e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success restore book",
+		"book":    view,
+	})
+}
+
+func (ctl *Controller) GetUserBooksController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	expand, e := expandAuthors(c)
+	if e != nil {
+		return e
+	}
+
+	if _, e := ctl.store.Users.GetUserById(ctx, id); e != nil {
+		return e
+	}
+
+	books, e := ctl.store.Books.GetBooksByUserId(ctx, id)
+	if e != nil {
+		return e
+	}
+	views, e := ctl.bookViews(ctx, expand, dto.NewBooks(books))
+	if e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"books":   views,
+	})
+}
+
+// AUTHORS CONTROLLERS
+func (ctl *Controller) CreateAuthorController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req dto.CreateAuthorRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+
+	author := req.Model()
+	if e := ctl.store.Authors.CreateAuthor(ctx, &author); e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success add new author",
+		"author":  dto.NewAuthor(author),
+	})
+}
+
+func (ctl *Controller) GetAuthorsController(c echo.Context) error {
+	ctx := c.Request().Context()
+	opts, e := listOptions(c)
+	if e != nil {
+		return e
+	}
+	filter := database.AuthorFilter{Name: c.QueryParam("name")}
+
+	authors, page, e := ctl.store.Authors.GetAuthors(ctx, filter, opts)
+	if e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"authors": dto.NewAuthors(authors),
+		"page":    pageLinks(c, opts, page),
+	})
+}
+
+func (ctl *Controller) GetAuthorByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	author, e := ctl.store.Authors.GetAuthorById(ctx, id)
+	if e != nil {
+		return e
+	}
+	setETag(c, author.Version)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"author":  dto.NewAuthor(author),
+	})
+}
+
+// UpdateAuthorByIdController renames an author, and with that the bylines
+// of their books.
+func (ctl *Controller) UpdateAuthorByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req dto.UpdateAuthorRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	current, e := ctl.store.Authors.GetAuthorById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if e := ifMatch(c, current.Version); e != nil {
+		return e
+	}
+
+	author := req.Apply(current)
+	if e := ctl.store.Authors.UpdateAuthorById(ctx, id, &author); e != nil {
+		return e
+	}
+	updated, e := ctl.store.Authors.GetAuthorById(ctx, id)
+	if e != nil {
+		return e
+	}
+	setETag(c, updated.Version)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success update author",
+		"author":  dto.NewAuthor(updated),
+	})
+}
+
+// DeleteAuthorByIdController deletes an author who has no books left.
+func (ctl *Controller) DeleteAuthorByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if _, e := ctl.store.Authors.GetAuthorById(ctx, id); e != nil {
+		return e
+	}
+	if e := ctl.store.Authors.DeleteAuthorById(ctx, id); e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success delete author",
+	})
+}
+
+// LOANS CONTROLLERS
+
+// CheckOutBookController lends a copy of a book, to the user whose token
+// asks for it unless an admin names someone else.
+func (ctl *Controller) CheckOutBookController(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req dto.CreateLoanRequest
+	if e := c.Bind(&req); e != nil {
+		return e
+	}
+	if e := validation.Struct(&req); e != nil {
+		return e
+	}
+
+	userId := uint(middlewares.ExtractTokenUserId(c))
+	if req.UserID != 0 && req.UserID != userId && !isAdmin(c) {
+		return apierror.New(http.StatusForbidden, "only an admin can lend books to other users")
+	}
+	if req.DueAt != nil && !req.DueAt.After(time.Now()) {
+		return apierror.New(http.StatusBadRequest, "due_at must be in the future")
+	}
+
+	loan := req.Model(userId, config.LOAN_PERIOD)
+	if e := ctl.store.Loans.CheckOutBook(ctx, &loan); e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success check out book",
+		"loan":    dto.NewLoan(loan),
+	})
+}
+
+func (ctl *Controller) GetLoansController(c echo.Context) error {
+	opts, e := listOptions(c)
+	if e != nil {
+		return e
+	}
+	filter := database.LoanFilter{Status: c.QueryParam("status")}
+	userID, e := intQueryParam(c, "user_id")
+	if e != nil {
+		return e
+	}
+	bookID, e := intQueryParam(c, "book_id")
+	if e != nil {
+		return e
+	}
+	filter.UserID, filter.BookID = uint(userID), uint(bookID)
+	return ctl.listLoans(c, filter, opts)
+}
+
+// GetOverdueLoansController lists the loans past their due date, the most
+// overdue first unless the request sorts otherwise.
+func (ctl *Controller) GetOverdueLoansController(c echo.Context) error {
+	opts, e := listOptions(c)
+	if e != nil {
+		return e
+	}
+	if opts.Sort == "" {
+		opts.Sort = "due_at"
+	}
+	return ctl.listLoans(c, database.LoanFilter{Status: database.LoanOverdue}, opts)
+}
+
+// GetUserLoansController lists the loans of a user, returned ones included,
+// unless the status parameter narrows them down.
+func (ctl *Controller) GetUserLoansController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+	opts, e := listOptions(c)
+	if e != nil {
+		return e
+	}
+
+	if _, e := ctl.store.Users.GetUserById(ctx, id); e != nil {
+		return e
+	}
+	return ctl.listLoans(c, database.LoanFilter{UserID: uint(id), Status: c.QueryParam("status")}, opts)
+}
+
+func (ctl *Controller) listLoans(c echo.Context, filter database.LoanFilter, opts database.ListOptions) error {
+	loans, page, e := ctl.store.Loans.GetLoans(c.Request().Context(), filter, opts)
+	if e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"loans":   dto.NewLoans(loans),
+		"page":    pageLinks(c, opts, page),
+	})
+}
+
+func (ctl *Controller) GetLoanByIdController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	loan, e := ctl.store.Loans.GetLoanById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if !isBorrower(c, loan) {
+		return apierror.New(http.StatusForbidden, "only the borrower or an admin can see this loan")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"loan":    dto.NewLoan(loan),
+	})
+}
+
+// ReturnLoanController gives the copy of a loan back, for someone else to
+// borrow.
+func (ctl *Controller) ReturnLoanController(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	loan, e := ctl.store.Loans.GetLoanById(ctx, id)
+	if e != nil {
+		return e
+	}
+	if !isBorrower(c, loan) {
+		return apierror.New(http.StatusForbidden, "only the borrower or an admin can return this loan")
+	}
+
+	returned, e := ctl.store.Loans.ReturnLoanById(ctx, id)
+	if e != nil {
+		return e
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success return book",
+		"loan":    dto.NewLoan(returned),
+	})
+}
+
+// canModifyBook reports whether the user behind the request's token may
+// update or delete book: its owner or an admin.
+func canModifyBook(c echo.Context, book models.Books) bool {
+	if isAdmin(c) {
+		return true
+	}
+	userId := middlewares.ExtractTokenUserId(c)
+	return userId != 0 && uint(userId) == book.UserID
+}
+
+// isBorrower reports whether the user behind the request's token may see
+// and return loan: its borrower or an admin.
+func isBorrower(c echo.Context, loan models.Loans) bool {
+	if isAdmin(c) {
+		return true
+	}
+	userId := middlewares.ExtractTokenUserId(c)
+	return userId != 0 && uint(userId) == loan.UserID
+}
+
+// includeDeleted reads the include_deleted query parameter, which only
+// admins may set.
+func includeDeleted(c echo.Context) (bool, error) {
+	value := c.QueryParam("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+	include, e := strconv.ParseBool(value)
+	if e != nil {
+		return false, apierror.New(http.StatusBadRequest, "include_deleted must be true or false")
+	}
+	if include && !isAdmin(c) {
+		return false, apierror.New(http.StatusForbidden, "only an admin can see deleted records")
+	}
+	return include, nil
+}
+
+func isAdmin(c echo.Context) bool {
+	return middlewares.ExtractTokenRole(c) == models.RoleAdmin
+}
@@ -1,37 +1,99 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 	"users-books-api-testing/config"
+	"users-books-api-testing/lib/apierror"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/health"
+	"users-books-api-testing/lib/search"
+	"users-books-api-testing/middlewares"
+	"users-books-api-testing/models"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
+var ctl *Controller
+
+func TestMain(m *testing.M) {
+	// run against an in-memory store seeded with the records the test cases
+	// below expect
+	store := database.NewMemoryStore()
+	seedFixtures(store)
+	if err := store.IndexBooks(context.Background(), search.NewMemoryIndex(database.BookSearchWeights)); err != nil {
+		panic(err)
+	}
+	ctl = New(store)
+
+	os.Exit(m.Run())
+}
+
+func seedFixtures(store *database.Store) {
+	users := []models.Users{
+		{Name: "deleted", Email: "deleted@example.com", Password: "deleted"},
+		{Name: "tony", Email: "tony@example.com", Password: "stark"},
+		{Name: "bruce", Email: "bruce@example.com", Password: "banner"},
+		{Name: "peter", Email: "peter@example.com", Password: "parker"},
+	}
+	for i, id := range []uint{2, 4, 43, 36} {
+		users[i].ID = id
+		store.Users.CreateUser(context.Background(), &users[i])
+	}
+	store.Users.DeleteUserById(context.Background(), 2)
+
+	books := []models.Books{
+		{Title: "dune", Author: "frank herbert", Year: 1965, UserID: 4},
+		{Title: "deleted", Author: "deleted", Year: 2000, UserID: 4},
+		{Title: "neuromancer", Author: "william gibson", Year: 1984, UserID: 4},
+		{Title: "hyperion", Author: "dan simmons", Year: 1989, UserID: 43},
+	}
+	for i, id := range []uint{1, 2, 4, 6} {
+		books[i].ID = id
+		store.Books.AddBook(context.Background(), &books[i])
+	}
+	store.Books.DeleteBookById(context.Background(), 2)
+}
+
 func InitEcho() *echo.Echo {
 	// Setup
-	config.InitDB()
 	e := echo.New()
+	e.HTTPErrorHandler = middlewares.ErrorHandler
 
 	return e
 }
 
+// serve runs handler and renders the error it returns, if any, the way the
+// router would.
+func serve(c echo.Context, handler echo.HandlerFunc) {
+	if err := handler(c); err != nil {
+		c.Echo().HTTPErrorHandler(err, c)
+	}
+}
+
 func TestGetUsersControllers(t *testing.T) {
 	var testCases = []struct {
 		testName             string
 		path                 string
 		expectStatus         int
 		expectBodyStartsWith string
+		expectBodyContains   string
 	}{
 		{
 			testName:             "success",
 			path:                 "/users",
-			expectBodyStartsWith: "{\"message\":\"success\",\"users\":[",
+			expectBodyStartsWith: "{\"message\":\"success\",\"page\":{",
+			expectBodyContains:   "\"users\":[",
 			expectStatus:         http.StatusOK,
 		},
 	}
@@ -45,10 +107,11 @@ func TestGetUsersControllers(t *testing.T) {
 		c.SetPath(testCase.path)
 
 		// Assertions
-		if assert.NoError(t, GetUsersController(c)) {
+		if assert.NoError(t, ctl.GetUsersController(c)) {
 			assert.Equal(t, http.StatusOK, rec.Code)
 			body := rec.Body.String()
 			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains))
 		}
 	}
 }
@@ -73,14 +136,14 @@ func TestGetUserByIdController(t *testing.T) {
 			path:                 "/users/",
 			id:                   2,
 			expectStatus:         http.StatusNotFound,
-			expectBodyStartsWith: "{\"message",
+			expectBodyStartsWith: "{\"code\":\"not_found\"",
 		},
 		{
 			testName:             "success",
 			path:                 "/users/",
 			id:                   4,
 			expectStatus:         http.StatusOK,
-			expectBodyStartsWith: "{\"message\":\"success\",\"user\":{\"ID\":4",
+			expectBodyStartsWith: "{\"message\":\"success\",\"user\":{\"id\":4",
 		},
 	}
 
@@ -94,11 +157,10 @@ func TestGetUserByIdController(t *testing.T) {
 		c.SetParamNames("id")
 		c.SetParamValues(strconv.Itoa(testCase.id))
 		// Assertion
-		if assert.NoError(t, GetUserByIdController(c)) {
-			assert.Equal(t, testCase.expectStatus, rec.Code)
-			body := rec.Body.String()
-			assert.True(t, strings.Contains(body, testCase.expectBodyStartsWith))
-		}
+		serve(c, ctl.GetUserByIdController)
+		assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
+		body := rec.Body.String()
+		assert.True(t, strings.Contains(body, testCase.expectBodyStartsWith), testCase.testName)
 	}
 }
 
@@ -117,12 +179,53 @@ func TestCreateUserController(t *testing.T) {
 			testName:             "success",
 			path:                 "/users",
 			name:                 "iron",
-			email:                "m@rvel",
-			password:             "man",
+			email:                "m@rvel.com",
+			password:             "iron man 3",
 			expectStatus:         http.StatusOK,
 			expectBodyStartsWith: "{\"message\":\"success create",
 			expectBodyContains:   "iron",
 		},
+		{
+			testName:             "success (email stored in lower case)",
+			path:                 "/users",
+			name:                 "hulk",
+			email:                "Hulk@Marvel.com",
+			password:             "smash 123",
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"message\":\"success create",
+			expectBodyContains:   "\"email\":\"hulk@marvel.com\"",
+		},
+		{
+			testName:     "un-success (duplicate email)",
+			path:         "/users",
+			name:         "tony",
+			email:        "TONY@example.com",
+			password:     "iron man 3",
+			expectStatus: http.StatusConflict,
+		},
+		{
+			testName:     "un-success (invalid email)",
+			path:         "/users",
+			name:         "iron",
+			email:        "m@",
+			password:     "iron man 3",
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:     "un-success (weak password)",
+			path:         "/users",
+			name:         "iron",
+			email:        "m@rvel.com",
+			password:     "man",
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:     "un-success (missing name)",
+			path:         "/users",
+			email:        "m@rvel.com",
+			password:     "iron man 3",
+			expectStatus: http.StatusUnprocessableEntity,
+		},
 	}
 
 	e := InitEcho()
@@ -140,7 +243,12 @@ func TestCreateUserController(t *testing.T) {
 		c := e.NewContext(req, rec)
 		c.SetPath(testCase.path)
 
-		if assert.NoError(t, CreateUserController(c)) {
+		err := ctl.CreateUserController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err) {
 			assert.Equal(t, testCase.expectStatus, rec.Code)
 			body := rec.Body.String()
 			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
@@ -154,9 +262,11 @@ func TestUpdateUserByIdController(t *testing.T) {
 		testName             string
 		path                 string
 		id                   int
+		role                 string
 		name                 string
 		email                string
 		password             string
+		newRole              string
 		expectStatus         int
 		expectBodyStartsWith string
 		expectBodyContains   string
@@ -165,11 +275,49 @@ func TestUpdateUserByIdController(t *testing.T) {
 			testName:             "success",
 			path:                 "/users/",
 			id:                   43,
+			role:                 models.RoleMember,
 			name:                 "setrika",
 			expectStatus:         http.StatusOK,
 			expectBodyStartsWith: "{\"message\":\"success update",
 			expectBodyContains:   "setrika",
 		},
+		{
+			testName:     "un-success (member changing role)",
+			path:         "/users/",
+			id:           43,
+			role:         models.RoleMember,
+			newRole:      models.RoleAdmin,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:             "success (member sending their own role back)",
+			path:                 "/users/",
+			id:                   43,
+			role:                 models.RoleMember,
+			name:                 "setrika",
+			newRole:              models.RoleMember,
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"message\":\"success update",
+			expectBodyContains:   "\"role\":\"member\"",
+		},
+		{
+			testName:     "un-success (email of another user)",
+			path:         "/users/",
+			id:           43,
+			role:         models.RoleMember,
+			email:        "Tony@Example.com",
+			expectStatus: http.StatusConflict,
+		},
+		{
+			testName:             "success (admin changing role)",
+			path:                 "/users/",
+			id:                   43,
+			role:                 models.RoleAdmin,
+			newRole:              models.RoleAdmin,
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"message\":\"success update",
+			expectBodyContains:   "\"role\":\"admin\"",
+		},
 	}
 
 	e := InitEcho()
@@ -179,6 +327,7 @@ func TestUpdateUserByIdController(t *testing.T) {
 			"name":     testCase.name,
 			"email":    testCase.email,
 			"password": testCase.password,
+			"role":     testCase.newRole,
 		}
 		data, _ := json.Marshal(user)
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
@@ -188,8 +337,14 @@ func TestUpdateUserByIdController(t *testing.T) {
 		c.SetPath(testCase.path)
 		c.SetParamNames("id")
 		c.SetParamValues(strconv.Itoa(testCase.id))
+		withRole(t, c, testCase.id, testCase.role)
 
-		if assert.NoError(t, UpdateUserByIdController(c)) {
+		err := ctl.UpdateUserByIdController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err) {
 			assert.Equal(t, testCase.expectStatus, rec.Code)
 			body := rec.Body.String()
 			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
@@ -198,248 +353,1719 @@ func TestUpdateUserByIdController(t *testing.T) {
 	}
 }
 
-func TestDeleteUserByIdController(t *testing.T) {
+func TestAuthorizeMiddlewares(t *testing.T) {
 	var testCases = []struct {
-		testName             string
-		path                 string
-		id                   int
-		expectStatus         int
-		expectBodyStartsWith string
+		testName     string
+		middleware   echo.MiddlewareFunc
+		userId       int
+		role         string
+		id           int
+		expectStatus int
 	}{
 		{
-			testName:             "success",
-			path:                 "/users",
-			id:                   36,
-			expectStatus:         http.StatusOK,
-			expectBodyStartsWith: "{\"message\":\"success delete",
+			testName:     "admin only (admin)",
+			middleware:   middlewares.Authorize(models.RoleAdmin),
+			userId:       4,
+			role:         models.RoleAdmin,
+			expectStatus: http.StatusOK,
+		},
+		{
+			testName:     "admin only (member)",
+			middleware:   middlewares.Authorize(models.RoleAdmin),
+			userId:       4,
+			role:         models.RoleMember,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:     "self or admin (self)",
+			middleware:   middlewares.AuthorizeSelfOr("id", models.RoleAdmin),
+			userId:       4,
+			role:         models.RoleMember,
+			id:           4,
+			expectStatus: http.StatusOK,
+		},
+		{
+			testName:     "self or admin (someone else)",
+			middleware:   middlewares.AuthorizeSelfOr("id", models.RoleAdmin),
+			userId:       4,
+			role:         models.RoleMember,
+			id:           43,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:     "self or admin (admin)",
+			middleware:   middlewares.AuthorizeSelfOr("id", models.RoleAdmin),
+			userId:       4,
+			role:         models.RoleAdmin,
+			id:           43,
+			expectStatus: http.StatusOK,
 		},
 	}
+
 	e := InitEcho()
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
 
 	for _, testCase := range testCases {
-		req := httptest.NewRequest(http.MethodDelete, "/", nil)
 		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-		c.SetPath(testCase.path)
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
 		c.SetParamNames("id")
 		c.SetParamValues(strconv.Itoa(testCase.id))
+		withRole(t, c, testCase.userId, testCase.role)
 
-		if assert.NoError(t, DeleteUserByIdController(c)) {
-			assert.Equal(t, rec.Code, testCase.expectStatus)
-			body := rec.Body.String()
-			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
+		err := testCase.middleware(ok)(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
+			assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
 		}
 	}
 }
 
-func TestGetBooksControllers(t *testing.T) {
+func TestDeleteUserByIdController(t *testing.T) {
 	var testCases = []struct {
 		testName             string
 		path                 string
+		id                   int
 		expectStatus         int
 		expectBodyStartsWith string
-		expectBodyContains string
 	}{
 		{
 			testName:             "success",
-			path:                 "/books",
+			path:                 "/users",
+			id:                   36,
 			expectStatus:         http.StatusOK,
-			expectBodyStartsWith: "{\"books\":[",
-			expectBodyContains: "success",
+			expectBodyStartsWith: "{\"message\":\"success delete",
+		},
+		{
+			testName:     "un-success (already deleted)",
+			path:         "/users",
+			id:           36,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			testName:     "un-success (no such user)",
+			path:         "/users",
+			id:           999,
+			expectStatus: http.StatusNotFound,
 		},
 	}
-
 	e := InitEcho()
+	accessToken, _ := loginAs(t, e, "peter@example.com", "parker")
 
 	for _, testCase := range testCases {
-		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 		c.SetPath(testCase.path)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
 
-		// Assertions
-		if assert.NoError(t, GetBooksController(c)) {
-			assert.Equal(t, http.StatusOK, rec.Code)
+		err := ctl.DeleteUserByIdController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
+			assert.Equal(t, rec.Code, testCase.expectStatus)
 			body := rec.Body.String()
 			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
 		}
 	}
+
+	// peter's token went with his account
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	withToken(t, c, accessToken)
+	handler := middlewares.RejectRevokedTokens(ctl.store.Tokens)(ctl.GetUsersController)
+	if err := handler(c); assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	}
 }
 
-func TestGetBookByIdController(t *testing.T) {
+func TestLoginUserController(t *testing.T) {
 	var testCases = []struct {
-		testName             string
-		path                 string
-		id                   int
-		expectStatus         int
-		expectBodyStartsWith string
+		testName           string
+		path               string
+		email              string
+		password           string
+		expectStatus       int
+		expectBodyContains string
 	}{
 		{
-			testName:             "un-success (not found - deleted)",
-			path:                 "/books/",
-			id:                   2,
-			expectStatus:         http.StatusNotFound,
-			expectBodyStartsWith: "{\"message",
+			testName:     "un-success (wrong password)",
+			path:         "/login",
+			email:        "tony@example.com",
+			password:     "wrong",
+			expectStatus: http.StatusUnauthorized,
 		},
 		{
-			testName:             "success",
-			path:                 "/books/",
-			id:                   6,
-			expectStatus:         http.StatusOK,
-			expectBodyStartsWith: "{\"book\":{\"ID\":6",
+			testName:     "un-success (unknown email)",
+			path:         "/login",
+			email:        "nobody@example.com",
+			password:     "stark",
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			testName:           "success",
+			path:               "/login",
+			email:              "tony@example.com",
+			password:           "stark",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"access_token\":\"ey",
 		},
 	}
 
 	e := InitEcho()
 
 	for _, testCase := range testCases {
-		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		user := map[string]string{
+			"email":    testCase.email,
+			"password": testCase.password,
+		}
+		data, _ := json.Marshal(user)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 		c.SetPath(testCase.path)
-		c.SetParamNames("id")
-		c.SetParamValues(strconv.Itoa(testCase.id))
-		// Assertion
-		if assert.NoError(t, GetBookByIdController(c)) {
+
+		err := ctl.LoginUserController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
 			assert.Equal(t, testCase.expectStatus, rec.Code)
 			body := rec.Body.String()
-			assert.True(t, strings.Contains(body, testCase.expectBodyStartsWith))
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains))
+			assert.False(t, strings.Contains(body, "password"))
+			assert.False(t, strings.Contains(body, "$2a$"))
 		}
 	}
 }
 
-func TestAddBookController(t *testing.T) {
+func TestLoginThrottle(t *testing.T) {
+	// the clock stands still, so Retry-After is the whole wait
+	now := time.Now()
+	throttled := New(ctl.store)
+	throttled.logins = newLoginThrottle(config.LoginThrottle{
+		IPLimit:            6,
+		IPWindow:           time.Minute,
+		LockoutThreshold:   2,
+		LockoutDuration:    time.Minute,
+		LockoutMaxDuration: time.Hour,
+	}, func() time.Time { return now })
+
 	var testCases = []struct {
-		testName             string
-		path                 string
-		title                string
-		author               string
-		year                 int
-		expectStatus         int
-		expectBodyStartsWith string
-		expectBodyContains1   string
-		expectBodyContains2 string
+		testName         string
+		email            string
+		password         string
+		unlockUserId     int
+		expectStatus     int
+		expectRetryAfter string
 	}{
 		{
-			testName:             "success",
-			path:                 "/books",
-			title:                "iron",
-			author:               "m@rvel",
-			year:                 2019,
-			expectStatus:         http.StatusOK,
-			expectBodyStartsWith: "{\"book\":{",
-			expectBodyContains1:   "success",
-			expectBodyContains2: "iron",
+			testName:     "un-success (wrong password)",
+			email:        "bruce@example.com",
+			password:     "wrong",
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			testName:     "un-success (wrong password again, locks the account)",
+			email:        "bruce@example.com",
+			password:     "wrong",
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			testName:         "un-success (locked, even with the right password)",
+			email:            "bruce@example.com",
+			password:         "banner",
+			expectStatus:     http.StatusTooManyRequests,
+			expectRetryAfter: "60",
+		},
+		{
+			testName:         "un-success (locked, whatever the case of the email)",
+			email:            "Bruce@Example.com",
+			password:         "banner",
+			expectStatus:     http.StatusTooManyRequests,
+			expectRetryAfter: "60",
+		},
+		{
+			testName:     "success (unlocked by an admin)",
+			email:        "bruce@example.com",
+			password:     "banner",
+			unlockUserId: 43,
+			expectStatus: http.StatusOK,
+		},
+		{
+			testName:     "success (last attempt the address is allowed)",
+			email:        "tony@example.com",
+			password:     "stark",
+			expectStatus: http.StatusOK,
+		},
+		{
+			testName:         "un-success (too many attempts from the address)",
+			email:            "tony@example.com",
+			password:         "stark",
+			expectStatus:     http.StatusTooManyRequests,
+			expectRetryAfter: "60",
 		},
 	}
 
 	e := InitEcho()
 
 	for _, testCase := range testCases {
-		user := map[string]interface{}{
-			"title":  testCase.title,
-			"author": testCase.author,
-			"year":   testCase.year,
+		if testCase.unlockUserId != 0 {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/jwt/users/:id/unlock")
+			c.SetParamNames("id")
+			c.SetParamValues(strconv.Itoa(testCase.unlockUserId))
+			if !assert.NoError(t, throttled.UnlockUserController(c), testCase.testName) {
+				continue
+			}
 		}
-		data, _ := json.Marshal(user)
+
+		data, _ := json.Marshal(map[string]string{"email": testCase.email, "password": testCase.password})
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
-		c.SetPath(testCase.path)
+		c.SetPath("/login")
 
-		if assert.NoError(t, AddBookController(c)) {
-			assert.Equal(t, testCase.expectStatus, rec.Code)
-			body := rec.Body.String()
-			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
-			assert.True(t, strings.Contains(body, testCase.expectBodyContains1))
-			assert.True(t, strings.Contains(body, testCase.expectBodyContains2))
-		}
+		serve(c, throttled.LoginUserController)
+		assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
+		assert.Equal(t, testCase.expectRetryAfter, rec.Header().Get("Retry-After"), testCase.testName)
 	}
 }
 
-func TestUpdateBookByIdController(t *testing.T) {
+// loginAs logs in through LoginUserController and returns the access and
+// refresh tokens from the response.
+func loginAs(t *testing.T, e *echo.Echo, email, password string) (string, string) {
+	data, _ := json.Marshal(map[string]string{"email": email, "password": password})
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/login")
+
+	if !assert.NoError(t, ctl.LoginUserController(c)) {
+		t.FailNow()
+	}
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return body.AccessToken, body.RefreshToken
+}
+
+// withToken stores the parsed access token on c the way the JWT middleware
+// would.
+func withToken(t *testing.T, c echo.Context, accessToken string) {
+	token, err := jwt.Parse(accessToken, func(*jwt.Token) (interface{}, error) {
+		return []byte(config.SECRET_JWT), nil
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	c.Set("user", token)
+}
+
+// withUser signs in the member with the given id for the request c.
+func withUser(t *testing.T, c echo.Context, userId int) {
+	withRole(t, c, userId, models.RoleMember)
+}
+
+func withRole(t *testing.T, c echo.Context, userId int, role string) {
+	token, err := middlewares.CreateToken(userId, role)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	withToken(t, c, token)
+}
+
+// assertHTTPError checks that err renders with expectStatus through the
+// error envelope.
+func assertHTTPError(t *testing.T, expectStatus int, err error, testName string) {
+	if assert.Error(t, err, testName) {
+		assert.Equal(t, expectStatus, apierror.From(err).Status, testName)
+	}
+}
+
+func TestRefreshTokenController(t *testing.T) {
+	e := InitEcho()
+	_, refreshToken := loginAs(t, e, "bruce@example.com", "banner")
+
 	var testCases = []struct {
-		testName             string
-		path                 string
-		id                   int
-		title                string
-		author               string
-		year                 int
-		expectStatus         int
-		expectBodyStartsWith string
-		expectBodyContains1   string
-		expectBodyContains2 string
+		testName           string
+		path               string
+		refreshToken       string
+		expectStatus       int
+		expectBodyContains string
 	}{
 		{
-			testName:             "success",
-			path:                 "/books/",
-			id:                   1,
-			title:                "setrika",
-			expectStatus:         http.StatusOK,
-			expectBodyStartsWith: "{\"book\":{",
-			expectBodyContains1:   "success",
-			expectBodyContains2: "setrika",
+			testName:           "success",
+			path:               "/refresh",
+			refreshToken:       refreshToken,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"refresh_token\":",
+		},
+		{
+			testName:     "un-success (already rotated)",
+			path:         "/refresh",
+			refreshToken: refreshToken,
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			testName:     "un-success (unknown token)",
+			path:         "/refresh",
+			refreshToken: "not-a-token",
+			expectStatus: http.StatusUnauthorized,
 		},
 	}
 
-	e := InitEcho()
-
 	for _, testCase := range testCases {
-		user := map[string]interface{}{
-			"title":  testCase.title,
-			"author": testCase.author,
-			"year":   testCase.year,
-		}
-		data, _ := json.Marshal(user)
+		data, _ := json.Marshal(map[string]string{"refresh_token": testCase.refreshToken})
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 		c.SetPath(testCase.path)
-		c.SetParamNames("id")
-		c.SetParamValues(strconv.Itoa(testCase.id))
 
-		if assert.NoError(t, UpdateBookByIdController(c)) {
+		err := ctl.RefreshTokenController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
 			assert.Equal(t, testCase.expectStatus, rec.Code)
 			body := rec.Body.String()
-			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
-			assert.True(t, strings.Contains(body, testCase.expectBodyContains1))
-			assert.True(t, strings.Contains(body, testCase.expectBodyContains2))
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains))
+			assert.False(t, strings.Contains(body, refreshToken))
 		}
 	}
 }
 
-func TestDeleteBookByIdController(t *testing.T) {
+func TestLogoutController(t *testing.T) {
+	e := InitEcho()
+	accessToken, refreshToken := loginAs(t, e, "bruce@example.com", "banner")
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/jwt/logout")
+	withToken(t, c, accessToken)
+
+	if assert.NoError(t, ctl.LogoutController(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "{\"message\":\"success logout"))
+	}
+
+	// the access token is now refused by the /jwt group
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	withToken(t, c, accessToken)
+	handler := middlewares.RejectRevokedTokens(ctl.store.Tokens)(ctl.GetUsersController)
+	if err := handler(c); assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, err.(*echo.HTTPError).Code)
+	}
+
+	// and so is the refresh token
+	_, _, err := ctl.store.Tokens.RotateRefreshToken(context.Background(), refreshToken)
+	assert.Equal(t, database.ErrInvalidRefreshToken, err)
+}
+
+func TestGetBooksControllers(t *testing.T) {
 	var testCases = []struct {
 		testName             string
 		path                 string
-		id                   int
+		query                string
+		admin                bool
 		expectStatus         int
 		expectBodyStartsWith string
+		expectBodyContains   string
 	}{
 		{
 			testName:             "success",
 			path:                 "/books",
-			id:                   4,
 			expectStatus:         http.StatusOK,
-			expectBodyStartsWith: "{\"message\":\"success delete book",
+			expectBodyStartsWith: "{\"books\":[",
+			expectBodyContains:   "success",
 		},
-	}
-	e := InitEcho()
-
-	for _, testCase := range testCases {
-		req := httptest.NewRequest(http.MethodDelete, "/", nil)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-		c.SetPath(testCase.path)
-		c.SetParamNames("id")
-		c.SetParamValues(strconv.Itoa(testCase.id))
-
-		if assert.NoError(t, DeleteBookByIdController(c)) {
-			assert.Equal(t, rec.Code, testCase.expectStatus)
+		{
+			testName:             "success (first page)",
+			path:                 "/books",
+			query:                "limit=2",
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"books\":[{\"id\":1",
+			expectBodyContains:   "\"next\":\"/books?limit=2\\u0026offset=2\"",
+		},
+		{
+			testName:             "success (sorted)",
+			path:                 "/books",
+			query:                "sort=-year&limit=1",
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"books\":[{\"id\":6",
+			expectBodyContains:   "\"total\":3",
+		},
+		{
+			testName:             "success (year range)",
+			path:                 "/books",
+			query:                "year_from=1980&year_to=1985",
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"books\":[{\"id\":4",
+			expectBodyContains:   "\"total\":1",
+		},
+		{
+			testName:             "success (title)",
+			path:                 "/books",
+			query:                "title=UNE",
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"books\":[{\"id\":1",
+			expectBodyContains:   "\"next\":null",
+		},
+		{
+			testName:     "un-success (sort column not allowed)",
+			path:         "/books",
+			query:        "sort=token",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (negative limit)",
+			path:         "/books",
+			query:        "limit=-5",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (negative offset)",
+			path:         "/books",
+			query:        "offset=-1",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:             "success (deleted included for admins)",
+			path:                 "/books",
+			query:                "include_deleted=true&limit=2",
+			admin:                true,
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"books\":[{\"id\":1",
+			expectBodyContains:   "\"total\":4",
+		},
+		{
+			testName:     "un-success (deleted included for members)",
+			path:         "/books",
+			query:        "include_deleted=true",
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:     "un-success (include_deleted not a boolean)",
+			path:         "/books",
+			query:        "include_deleted=maybe",
+			admin:        true,
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, testCase.path+"?"+testCase.query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(testCase.path)
+		if testCase.admin {
+			withRole(t, c, 4, models.RoleAdmin)
+		}
+
+		// Assertions
+		err := ctl.GetBooksController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			body := rec.Body.String()
+			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith), testCase.testName)
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains), testCase.testName)
+		}
+	}
+}
+
+func TestGetBooksControllersCursor(t *testing.T) {
+	e := InitEcho()
+
+	var ids []uint
+	for next := "/books?sort=year&limit=1"; next != ""; {
+		req := httptest.NewRequest(http.MethodGet, next, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/books")
+
+		if !assert.NoError(t, ctl.GetBooksController(c)) {
+			return
+		}
+		var body struct {
+			Books []models.Books `json:"books"`
+			Page  struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"page"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		for _, book := range body.Books {
+			ids = append(ids, book.ID)
+		}
+		next = ""
+		if body.Page.NextCursor != "" {
+			next = "/books?sort=year&limit=1&cursor=" + body.Page.NextCursor
+		}
+	}
+	assert.Equal(t, []uint{1, 4, 6}, ids)
+}
+
+func TestSearchBooksController(t *testing.T) {
+	var testCases = []struct {
+		testName           string
+		query              string
+		expectStatus       int
+		expectBodyContains string
+	}{
+		{
+			testName:           "success",
+			query:              "q=dune",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"highlights\":{\"title\":\"\\u003cem\\u003edune\\u003c/em\\u003e\"}",
+		},
+		{
+			testName:           "success (prefix and typo)",
+			query:              "q=hyper+simons",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"author\":\"dan \\u003cem\\u003esimmons\\u003c/em\\u003e\"",
+		},
+		{
+			testName:           "success (across fields)",
+			query:              "q=neuromancer+gibson",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"total\":1",
+		},
+		{
+			testName:           "success (deleted books aren't found)",
+			query:              "q=deleted",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"results\":[],\"total\":0",
+		},
+		{
+			testName:           "success (past the last page)",
+			query:              "q=dune&offset=5",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"results\":[],\"total\":1",
+		},
+		{
+			testName:     "un-success (no query)",
+			query:        "q=+",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (limit not a number)",
+			query:        "q=dune&limit=ten",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (negative offset)",
+			query:        "q=dune&offset=-1",
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/books/search?"+testCase.query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		withUser(t, c, 4)
+
+		err := ctl.SearchBooksController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
+			assert.Equal(t, testCase.expectStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), testCase.expectBodyContains, testCase.testName)
+		}
+	}
+}
+
+func TestGetBookByIdController(t *testing.T) {
+	var testCases = []struct {
+		testName             string
+		path                 string
+		id                   int
+		expectStatus         int
+		expectBodyStartsWith string
+	}{
+		{
+			testName:             "un-success (not found - deleted)",
+			path:                 "/books/",
+			id:                   2,
+			expectStatus:         http.StatusNotFound,
+			expectBodyStartsWith: "\"message\":\"record not found\"",
+		},
+		{
+			testName:             "success",
+			path:                 "/books/",
+			id:                   6,
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"book\":{\"id\":6",
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(testCase.path)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
+		// Assertion
+		serve(c, ctl.GetBookByIdController)
+		assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
+		body := rec.Body.String()
+		assert.True(t, strings.Contains(body, testCase.expectBodyStartsWith), testCase.testName)
+	}
+}
+
+func TestAddBookController(t *testing.T) {
+	var testCases = []struct {
+		testName             string
+		path                 string
+		userId               int
+		title                string
+		author               string
+		year                 int
+		expectStatus         int
+		expectBodyStartsWith string
+		expectBodyContains1  string
+		expectBodyContains2  string
+	}{
+		{
+			testName:             "success",
+			path:                 "/books",
+			userId:               4,
+			title:                "iron",
+			author:               "m@rvel",
+			year:                 2019,
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"book\":{",
+			expectBodyContains1:  "success",
+			expectBodyContains2:  "\"user_id\":4",
+		},
+		{
+			testName:     "un-success (invalid year)",
+			path:         "/books",
+			userId:       4,
+			title:        "iron",
+			author:       "m@rvel",
+			year:         -5,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:     "un-success (missing title)",
+			path:         "/books",
+			userId:       4,
+			author:       "m@rvel",
+			year:         2019,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		user := map[string]interface{}{
+			"title":  testCase.title,
+			"author": testCase.author,
+			"year":   testCase.year,
+		}
+		data, _ := json.Marshal(user)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(testCase.path)
+		withUser(t, c, testCase.userId)
+
+		err := ctl.AddBookController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err) {
+			assert.Equal(t, testCase.expectStatus, rec.Code)
+			body := rec.Body.String()
+			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains1))
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains2))
+		}
+	}
+}
+
+func TestRequestBodyFieldsWhitelisted(t *testing.T) {
+	var testCases = []struct {
+		testName      string
+		handler       func(*Controller) echo.HandlerFunc
+		userId        int
+		body          string
+		expectContain string
+		expectAbsent  []string
+	}{
+		{
+			testName:      "sign up can't pick id or role",
+			handler:       func(ctl *Controller) echo.HandlerFunc { return ctl.CreateUserController },
+			body:          `{"id":999,"name":"loki","email":"loki@asgard.com","password":"mischief 1","role":"admin","token":"forged"}`,
+			expectContain: "\"role\":\"member\"",
+			expectAbsent:  []string{"\"id\":999,", "\"admin\"", "password", "token", "forged"},
+		},
+		{
+			testName:      "new book can't pick id or owner",
+			handler:       func(ctl *Controller) echo.HandlerFunc { return ctl.AddBookController },
+			userId:        4,
+			body:          `{"id":999,"title":"edda","author":"snorri","year":1220,"user_id":1}`,
+			expectContain: "\"user_id\":4",
+			expectAbsent:  []string{"\"id\":999,", "\"user_id\":1,"},
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if testCase.userId != 0 {
+			withUser(t, c, testCase.userId)
+		}
+
+		if assert.NoError(t, testCase.handler(ctl)(c), testCase.testName) {
+			body := rec.Body.String()
+			assert.Contains(t, body, testCase.expectContain, testCase.testName)
+			for _, absent := range testCase.expectAbsent {
+				assert.NotContains(t, body, absent, testCase.testName)
+			}
+		}
+	}
+}
+
+func TestUpdateBookByIdController(t *testing.T) {
+	var testCases = []struct {
+		testName             string
+		path                 string
+		id                   int
+		userId               int
+		role                 string
+		title                string
+		author               string
+		year                 int
+		expectStatus         int
+		expectBodyStartsWith string
+		expectBodyContains1  string
+		expectBodyContains2  string
+	}{
+		{
+			testName:             "success",
+			path:                 "/books/",
+			id:                   1,
+			userId:               4,
+			title:                "setrika",
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"book\":{",
+			expectBodyContains1:  "success",
+			expectBodyContains2:  "setrika",
+		},
+		{
+			testName:     "un-success (not the owner)",
+			path:         "/books/",
+			id:           6,
+			userId:       4,
+			title:        "setrika",
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:     "un-success (not found - deleted)",
+			path:         "/books/",
+			id:           2,
+			userId:       4,
+			title:        "setrika",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			testName:             "success (admin)",
+			path:                 "/books/",
+			id:                   6,
+			userId:               36,
+			role:                 models.RoleAdmin,
+			title:                "setrika",
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"book\":{",
+			expectBodyContains1:  "success",
+			expectBodyContains2:  "setrika",
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		user := map[string]interface{}{
+			"title":  testCase.title,
+			"author": testCase.author,
+			"year":   testCase.year,
+		}
+		data, _ := json.Marshal(user)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(testCase.path)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
+		role := testCase.role
+		if role == "" {
+			role = models.RoleMember
+		}
+		withRole(t, c, testCase.userId, role)
+
+		err := ctl.UpdateBookByIdController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err) {
+			assert.Equal(t, testCase.expectStatus, rec.Code)
+			body := rec.Body.String()
+			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains1))
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains2))
+		}
+	}
+}
+
+func TestPatchControllers(t *testing.T) {
+	// the cases run in order against book 4 and users 43 and 4; ifMatch "current"
+	// stands for the ETag the record has when the case runs
+	var testCases = []struct {
+		testName           string
+		handler            func(*Controller) echo.HandlerFunc
+		id                 int
+		userId             int
+		role               string
+		contentType        string
+		ifMatch            string
+		patch              string
+		expectStatus       int
+		expectBodyContains string
+	}{
+		{
+			testName:           "success (null clears, zero is written)",
+			id:                 4,
+			userId:             4,
+			patch:              `{"author":null,"year":null}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"title\":\"neuromancer\",\"author\":\"\",\"year\":0,",
+		},
+		{
+			testName:           "success (matching If-Match)",
+			id:                 4,
+			userId:             4,
+			ifMatch:            "current",
+			patch:              `{"title":"count zero","year":1986}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"title\":\"count zero\",\"author\":\"\",\"year\":1986,",
+		},
+		{
+			testName:           "success (If-Match any)",
+			id:                 4,
+			userId:             4,
+			contentType:        echo.MIMEApplicationJSON,
+			ifMatch:            "*",
+			patch:              `{"author":"william gibson","id":99,"user_id":43}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"author\":\"william gibson\",\"year\":1986,\"user_id\":4,",
+		},
+		{
+			testName:     "un-success (stale If-Match)",
+			id:           4,
+			userId:       4,
+			ifMatch:      `"1"`,
+			patch:        `{"title":"mona lisa overdrive"}`,
+			expectStatus: http.StatusPreconditionFailed,
+		},
+		{
+			testName:     "un-success (title cleared)",
+			id:           4,
+			userId:       4,
+			patch:        `{"title":null}`,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:     "un-success (wrong type)",
+			id:           4,
+			userId:       4,
+			patch:        `{"year":"1986"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (not an object)",
+			id:           4,
+			userId:       4,
+			patch:        `["title"]`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (not JSON)",
+			id:           4,
+			userId:       4,
+			patch:        `{"title":`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (content type)",
+			id:           4,
+			userId:       4,
+			contentType:  echo.MIMETextPlain,
+			patch:        `{"title":"idoru"}`,
+			expectStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			testName:     "un-success (not the owner)",
+			id:           4,
+			userId:       43,
+			patch:        `{"title":"idoru"}`,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:     "un-success (not found - deleted)",
+			id:           2,
+			userId:       4,
+			patch:        `{"title":"idoru"}`,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			testName:           "success (user)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.PatchUserByIdController },
+			id:                 43,
+			userId:             43,
+			ifMatch:            "current",
+			patch:              `{"name":"spidey"}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"name\":\"spidey\",\"email\":\"bruce@example.com\"",
+		},
+		{
+			testName:     "un-success (member patching in a role)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.PatchUserByIdController },
+			id:           4,
+			userId:       4,
+			patch:        `{"role":"admin"}`,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:     "un-success (email cleared)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.PatchUserByIdController },
+			id:           43,
+			userId:       43,
+			patch:        `{"email":null}`,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:     "un-success (stale If-Match on PUT)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.UpdateUserByIdController },
+			id:           43,
+			userId:       43,
+			contentType:  echo.MIMEApplicationJSON,
+			ifMatch:      `"1"`,
+			patch:        `{"name":"bruce"}`,
+			expectStatus: http.StatusPreconditionFailed,
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		handler := ctl.PatchBookByIdController
+		get := ctl.GetBookByIdController
+		if testCase.handler != nil {
+			handler = testCase.handler(ctl)
+			get = ctl.GetUserByIdController
+		}
+		newContext := func(method, body string) (echo.Context, *httptest.ResponseRecorder) {
+			req := httptest.NewRequest(method, "/", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(strconv.Itoa(testCase.id))
+			role := testCase.role
+			if role == "" {
+				role = models.RoleMember
+			}
+			withRole(t, c, testCase.userId, role)
+			return c, rec
+		}
+
+		ifMatch := testCase.ifMatch
+		if ifMatch == "current" {
+			c, rec := newContext(http.MethodGet, "")
+			assert.NoError(t, get(c), testCase.testName)
+			ifMatch = rec.Header().Get("ETag")
+		}
+		contentType := testCase.contentType
+		if contentType == "" {
+			contentType = "application/merge-patch+json"
+		}
+
+		c, rec := newContext(http.MethodPatch, testCase.patch)
+		c.Request().Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			c.Request().Header.Set("If-Match", ifMatch)
+		}
+
+		err := handler(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
+			body := rec.Body.String()
+			assert.Contains(t, body, testCase.expectBodyContains, testCase.testName)
+			etag := rec.Header().Get("ETag")
+			assert.NotEqual(t, ifMatch, etag, testCase.testName)
+			assert.Contains(t, body, "\"version\":"+strings.Trim(etag, "\"")+"}", testCase.testName)
+		}
+	}
+}
+
+func TestDeleteBookByIdController(t *testing.T) {
+	var testCases = []struct {
+		testName             string
+		path                 string
+		id                   int
+		userId               int
+		expectStatus         int
+		expectBodyStartsWith string
+	}{
+		{
+			testName:     "un-success (not the owner)",
+			path:         "/books",
+			id:           4,
+			userId:       43,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:             "success",
+			path:                 "/books",
+			id:                   4,
+			userId:               4,
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"message\":\"success delete book",
+		},
+	}
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(testCase.path)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
+		withUser(t, c, testCase.userId)
+
+		err := ctl.DeleteBookByIdController(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err) {
+			assert.Equal(t, rec.Code, testCase.expectStatus)
 			body := rec.Body.String()
 			assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith))
 		}
 	}
 }
+
+func TestGetUserBooksController(t *testing.T) {
+	var testCases = []struct {
+		testName             string
+		path                 string
+		id                   int
+		expectStatus         int
+		expectBodyStartsWith string
+		expectBodyContains   string
+	}{
+		{
+			testName:             "success",
+			path:                 "/users/:id/books",
+			id:                   43,
+			expectStatus:         http.StatusOK,
+			expectBodyStartsWith: "{\"books\":[{\"id\":6",
+			expectBodyContains:   "\"user_id\":43",
+		},
+		{
+			testName:             "un-success (not found - deleted)",
+			path:                 "/users/:id/books",
+			id:                   2,
+			expectStatus:         http.StatusNotFound,
+			expectBodyStartsWith: "{\"code\":\"not_found\",\"message\":\"record not found\"",
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(testCase.path)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
+
+		serve(c, ctl.GetUserBooksController)
+		assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
+		body := rec.Body.String()
+		assert.True(t, strings.HasPrefix(body, testCase.expectBodyStartsWith), testCase.testName)
+		assert.True(t, strings.Contains(body, testCase.expectBodyContains), testCase.testName)
+	}
+}
+
+func TestRestoreControllers(t *testing.T) {
+	var testCases = []struct {
+		testName           string
+		path               string
+		id                 int
+		expectStatus       int
+		expectBodyContains string
+	}{
+		{
+			testName:           "success (user)",
+			path:               "/jwt/users/:id/restore",
+			id:                 2,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"email\":\"deleted@example.com\"",
+		},
+		{
+			testName:           "success (book)",
+			path:               "/jwt/books/:id/restore",
+			id:                 2,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"title\":\"deleted\"",
+		},
+		{
+			testName:           "success (book that isn't deleted)",
+			path:               "/jwt/books/:id/restore",
+			id:                 1,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"book\":{\"id\":1,",
+		},
+		{
+			testName:     "un-success (no such user)",
+			path:         "/jwt/users/:id/restore",
+			id:           999,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			testName:     "un-success (no such book)",
+			path:         "/jwt/books/:id/restore",
+			id:           999,
+			expectStatus: http.StatusNotFound,
+		},
+	}
+
+	e := InitEcho()
+	// leave the fixtures deleted for the tests that run after this one
+	defer ctl.store.Users.DeleteUserById(context.Background(), 2)
+	defer ctl.store.Books.DeleteBookById(context.Background(), 2)
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(testCase.path)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
+
+		handler := ctl.RestoreUserController
+		if strings.HasPrefix(testCase.path, "/jwt/books") {
+			handler = ctl.RestoreBookController
+		}
+		serve(c, handler)
+		assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
+		assert.True(t, strings.Contains(rec.Body.String(), testCase.expectBodyContains), testCase.testName)
+	}
+}
+
+func TestAuthorsControllers(t *testing.T) {
+	// the cases run in order; the fixtures' authors were added with their
+	// books, so frank herbert is author 1 and dan simmons author 4
+	var testCases = []struct {
+		testName           string
+		handler            func(*Controller) echo.HandlerFunc
+		method             string
+		query              string
+		id                 int
+		admin              bool
+		ifMatch            string
+		body               string
+		expectStatus       int
+		expectBodyContains string
+	}{
+		{
+			testName:           "success (book with its authors)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.GetBookByIdController },
+			query:              "expand=authors",
+			id:                 1,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"authors\":[{\"id\":1,\"name\":\"frank herbert\",",
+		},
+		{
+			testName:     "un-success (unknown expansion)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.GetBookByIdController },
+			query:        "expand=authors,reviews",
+			id:           1,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:           "success (create)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.CreateAuthorController },
+			method:             http.MethodPost,
+			body:               `{"name":" brian herbert ","id":1}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"name\":\"brian herbert\",",
+		},
+		{
+			testName:     "un-success (create without a name)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.CreateAuthorController },
+			method:       http.MethodPost,
+			body:         `{}`,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:           "success (list by name)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.GetAuthorsController },
+			query:              "name=HERBERT&sort=name",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"name\":\"brian herbert\"",
+		},
+		{
+			testName:           "success (book by several authors)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.AddBookController },
+			method:             http.MethodPost,
+			query:              "expand=authors",
+			body:               `{"title":"the fall of hyperion","author_ids":[4,1],"year":1990}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"author\":\"dan simmons, frank herbert\",",
+		},
+		{
+			testName:     "un-success (book by an unknown author)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.AddBookController },
+			method:       http.MethodPost,
+			body:         `{"title":"endymion","author_ids":[999],"year":1996}`,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:     "un-success (book by nobody)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.AddBookController },
+			method:       http.MethodPost,
+			body:         `{"title":"endymion","year":1996}`,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:           "success (rename)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.UpdateAuthorByIdController },
+			method:             http.MethodPut,
+			id:                 1,
+			admin:              true,
+			ifMatch:            `"1"`,
+			body:               `{"name":"Frank Herbert"}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"name\":\"Frank Herbert\",",
+		},
+		{
+			testName:     "un-success (rename a stale version)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.UpdateAuthorByIdController },
+			method:       http.MethodPut,
+			id:           1,
+			admin:        true,
+			ifMatch:      `"1"`,
+			body:         `{"name":"F. Herbert"}`,
+			expectStatus: http.StatusPreconditionFailed,
+		},
+		{
+			testName:           "success (books by an author have the new name)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.GetBooksController },
+			query:              "author_id=1&sort=id",
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"author\":\"dan simmons, Frank Herbert\",",
+		},
+		{
+			testName:     "un-success (delete an author with books)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.DeleteAuthorByIdController },
+			method:       http.MethodDelete,
+			id:           1,
+			admin:        true,
+			expectStatus: http.StatusConflict,
+		},
+		{
+			testName:     "un-success (delete no such author)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.DeleteAuthorByIdController },
+			method:       http.MethodDelete,
+			id:           999,
+			admin:        true,
+			expectStatus: http.StatusNotFound,
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		method := testCase.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, "/?"+testCase.query, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		if testCase.ifMatch != "" {
+			req.Header.Set("If-Match", testCase.ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
+		role := models.RoleMember
+		if testCase.admin {
+			role = models.RoleAdmin
+		}
+		withRole(t, c, 4, role)
+
+		err := testCase.handler(ctl)(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
+			assert.Contains(t, rec.Body.String(), testCase.expectBodyContains, testCase.testName)
+		}
+	}
+}
+
+func TestLoansControllers(t *testing.T) {
+	// the cases run in order, starting with bruce (43) a day late with
+	// dune; hyperion (6) has one copy, which tony (4) checks out next
+	overdue := models.Loans{BookID: 1, UserID: 43, DueAt: time.Now().Add(-24 * time.Hour)}
+	if !assert.NoError(t, ctl.store.Loans.CheckOutBook(context.Background(), &overdue)) {
+		t.FailNow()
+	}
+	checkout := int(overdue.ID) + 1
+	// return what is still out, so the test can run again
+	t.Cleanup(func() {
+		ctx := context.Background()
+		active, _, err := ctl.store.Loans.GetLoans(ctx, database.LoanFilter{Status: database.LoanActive}, database.ListOptions{Limit: database.MaxLimit})
+		assert.NoError(t, err)
+		for _, loan := range active {
+			_, err := ctl.store.Loans.ReturnLoanById(ctx, int(loan.ID))
+			assert.NoError(t, err)
+		}
+	})
+
+	var testCases = []struct {
+		testName           string
+		handler            func(*Controller) echo.HandlerFunc
+		method             string
+		query              string
+		id                 int
+		user               int
+		admin              bool
+		body               string
+		expectStatus       int
+		expectBodyContains string
+	}{
+		{
+			testName:           "success (check out)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.CheckOutBookController },
+			method:             http.MethodPost,
+			user:               4,
+			body:               `{"book_id":6}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"id\":" + strconv.Itoa(checkout) + ",\"book_id\":6,\"user_id\":4,",
+		},
+		{
+			testName:     "un-success (check out the last copy twice)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.CheckOutBookController },
+			method:       http.MethodPost,
+			user:         43,
+			body:         `{"book_id":6}`,
+			expectStatus: http.StatusConflict,
+		},
+		{
+			testName:     "un-success (member lends to someone else)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.CheckOutBookController },
+			method:       http.MethodPost,
+			user:         4,
+			body:         `{"book_id":1,"user_id":43}`,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:     "un-success (due in the past)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.CheckOutBookController },
+			method:       http.MethodPost,
+			user:         4,
+			body:         `{"book_id":1,"due_at":"2000-01-01T00:00:00Z"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:     "un-success (no such book)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.CheckOutBookController },
+			method:       http.MethodPost,
+			user:         4,
+			body:         `{"book_id":999}`,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			testName:     "un-success (no book)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.CheckOutBookController },
+			method:       http.MethodPost,
+			user:         4,
+			body:         `{}`,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:           "success (book with more copies)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.AddBookController },
+			method:             http.MethodPost,
+			user:               4,
+			body:               `{"title":"the stand","author":"stephen king","year":1978,"copies":2}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"copies\":2,",
+		},
+		{
+			testName:     "un-success (book without copies)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.AddBookController },
+			method:       http.MethodPost,
+			user:         4,
+			body:         `{"title":"carrie","author":"stephen king","year":1974,"copies":-1}`,
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			testName:     "un-success (see someone else's loan)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.GetLoanByIdController },
+			id:           checkout,
+			user:         43,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:           "success (see own loan)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.GetLoanByIdController },
+			id:                 checkout,
+			user:               4,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"returned_at\":null,\"overdue\":false,",
+		},
+		{
+			testName:           "success (list the loans of a book)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.GetLoansController },
+			query:              "book_id=6&status=active",
+			user:               43,
+			admin:              true,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"total\":1}",
+		},
+		{
+			testName:     "un-success (delete a book that is lent out)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.DeleteBookByIdController },
+			method:       http.MethodDelete,
+			id:           6,
+			user:         43,
+			admin:        true,
+			expectStatus: http.StatusConflict,
+		},
+		{
+			testName:     "un-success (list by an unknown status)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.GetLoansController },
+			query:        "status=lost",
+			user:         43,
+			admin:        true,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			testName:           "success (list overdue loans)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.GetOverdueLoansController },
+			user:               43,
+			admin:              true,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"loans\":[{\"id\":" + strconv.Itoa(int(overdue.ID)) + ",\"book_id\":1,\"user_id\":43,",
+		},
+		{
+			testName:           "success (list a user's loans)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.GetUserLoansController },
+			id:                 43,
+			user:               43,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"overdue\":true,",
+		},
+		{
+			testName:     "un-success (list the loans of no such user)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.GetUserLoansController },
+			id:           999,
+			user:         43,
+			admin:        true,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			testName:     "un-success (return someone else's loan)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.ReturnLoanController },
+			method:       http.MethodPost,
+			id:           checkout,
+			user:         43,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			testName:           "success (return)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.ReturnLoanController },
+			method:             http.MethodPost,
+			id:                 checkout,
+			user:               4,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"message\":\"success return book\"",
+		},
+		{
+			testName:     "un-success (return twice)",
+			handler:      func(ctl *Controller) echo.HandlerFunc { return ctl.ReturnLoanController },
+			method:       http.MethodPost,
+			id:           checkout,
+			user:         4,
+			expectStatus: http.StatusConflict,
+		},
+		{
+			testName:           "success (check out the returned copy)",
+			handler:            func(ctl *Controller) echo.HandlerFunc { return ctl.CheckOutBookController },
+			method:             http.MethodPost,
+			user:               43,
+			body:               `{"book_id":6}`,
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"book_id\":6,\"user_id\":43,",
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		method := testCase.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, "/?"+testCase.query, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(testCase.id))
+		role := models.RoleMember
+		if testCase.admin {
+			role = models.RoleAdmin
+		}
+		withRole(t, c, testCase.user, role)
+
+		err := testCase.handler(ctl)(c)
+		if testCase.expectStatus != http.StatusOK {
+			assertHTTPError(t, testCase.expectStatus, err, testCase.testName)
+			continue
+		}
+		if assert.NoError(t, err, testCase.testName) {
+			assert.Contains(t, rec.Body.String(), testCase.expectBodyContains, testCase.testName)
+		}
+	}
+}
+
+func TestRequestContextDone(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	var testCases = []struct {
+		testName           string
+		ctx                context.Context
+		expectStatus       int
+		expectBodyContains string
+	}{
+		{
+			testName:           "un-success (deadline exceeded)",
+			ctx:                expired,
+			expectStatus:       http.StatusServiceUnavailable,
+			expectBodyContains: "\"message\":\"the request timed out\"",
+		},
+		{
+			testName:           "un-success (client went away)",
+			ctx:                canceled,
+			expectStatus:       http.StatusServiceUnavailable,
+			expectBodyContains: "\"message\":\"the request was canceled\"",
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(testCase.ctx)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/jwt/books/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		serve(c, ctl.GetBookByIdController)
+		assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
+		assert.True(t, strings.Contains(rec.Body.String(), testCase.expectBodyContains), testCase.testName)
+	}
+}
+
+func TestReadinessController(t *testing.T) {
+	ok := health.Check{Name: "database", Run: func(context.Context) error { return nil }}
+	failing := health.Check{Name: "migrations", Run: func(context.Context) error { return errors.New("1 pending") }}
+
+	var testCases = []struct {
+		testName           string
+		checks             []health.Check
+		expectStatus       int
+		expectBodyContains string
+	}{
+		{
+			testName:           "success",
+			checks:             []health.Check{ok},
+			expectStatus:       http.StatusOK,
+			expectBodyContains: "\"checks\":{\"database\":\"ok\"}",
+		},
+		{
+			testName:           "un-success (failing check)",
+			checks:             []health.Check{ok, failing},
+			expectStatus:       http.StatusServiceUnavailable,
+			expectBodyContains: "\"migrations\":\"1 pending\"",
+		},
+	}
+
+	e := InitEcho()
+
+	for _, testCase := range testCases {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+
+		if assert.NoError(t, NewHealth(testCase.checks...).ReadinessController(c), testCase.testName) {
+			assert.Equal(t, testCase.expectStatus, rec.Code, testCase.testName)
+			body := rec.Body.String()
+			assert.True(t, strings.Contains(body, testCase.expectBodyContains), testCase.testName)
+			assert.True(t, strings.Contains(body, "\"version\":\"dev\""), testCase.testName)
+		}
+	}
+}
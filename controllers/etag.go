@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"users-books-api-testing/lib/apierror"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/mergepatch"
+
+	"github.com/labstack/echo/v4"
+)
+
+// etag is the entity tag of a user or book at version.
+func etag(version uint) string {
+	return strconv.Quote(strconv.FormatUint(uint64(version), 10))
+}
+
+func setETag(c echo.Context, version uint) {
+	c.Response().Header().Set("ETag", etag(version))
+}
+
+// ifMatch fails with database.ErrStaleVersion unless the request's If-Match
+// header, if it has one, names the ETag of the record's current version.
+func ifMatch(c echo.Context, version uint) error {
+	header := c.Request().Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag(version) {
+			return nil
+		}
+	}
+	return database.ErrStaleVersion
+}
+
+// readPatch reads the request's body, which must be a JSON Merge Patch
+// object. Plain application/json is taken to be one too.
+func readPatch(c echo.Context) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != mergepatch.ContentType && mediaType != echo.MIMEApplicationJSON {
+		return nil, apierror.New(http.StatusUnsupportedMediaType, "the body must be "+mergepatch.ContentType)
+	}
+	patch, e := io.ReadAll(c.Request().Body)
+	if e != nil {
+		return nil, e
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(patch)), "{") {
+		return nil, apierror.New(http.StatusBadRequest, "the patch must be a JSON object")
+	}
+	return patch, nil
+}
+
+// applyPatch merges patch into target, a pointer to the request type holding
+// the current values of the record.
+func applyPatch(patch []byte, target interface{}) error {
+	doc, e := json.Marshal(target)
+	if e != nil {
+		return e
+	}
+	merged, e := mergepatch.Apply(doc, patch)
+	if errors.Is(e, mergepatch.ErrInvalid) {
+		return apierror.New(http.StatusBadRequest, e.Error())
+	}
+	if e != nil {
+		return e
+	}
+
+	// members the patch removed must come out zero, not as they were
+	v := reflect.ValueOf(target).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	var typeErr *json.UnmarshalTypeError
+	if e := json.Unmarshal(merged, target); errors.As(e, &typeErr) {
+		return apierror.New(http.StatusBadRequest, fmt.Sprintf("%s must be a JSON %s", typeErr.Field, jsonType(typeErr.Type)))
+	} else if e != nil {
+		return e
+	}
+	return nil
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Bool:
+		return "boolean"
+	default:
+		return t.Kind().String()
+	}
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"users-books-api-testing/dto"
+	"users-books-api-testing/lib/apierror"
+
+	"github.com/labstack/echo/v4"
+)
+
+// expandAuthors reads the expand query parameter, a comma separated list of
+// what to embed in the books of the response. The only thing books can have
+// embedded is their authors.
+func expandAuthors(c echo.Context) (bool, error) {
+	expand := false
+	for _, name := range strings.Split(c.QueryParam("expand"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "authors":
+			expand = true
+		default:
+			return false, apierror.New(http.StatusBadRequest, fmt.Sprintf("cannot expand %q", name))
+		}
+	}
+	return expand, nil
+}
+
+// withAuthors embeds their authors in books if expand is set.
+func (ctl *Controller) withAuthors(ctx context.Context, expand bool, books ...*dto.Book) error {
+	if !expand || len(books) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	authors, e := ctl.store.Authors.GetAuthorsOfBooks(ctx, ids)
+	if e != nil {
+		return e
+	}
+	for _, book := range books {
+		*book = book.WithAuthors(authors[book.ID])
+	}
+	return nil
+}
+
+// bookViews returns books as clients see them, with their authors if expand
+// is set.
+func (ctl *Controller) bookViews(ctx context.Context, expand bool, books []dto.Book) ([]dto.Book, error) {
+	refs := make([]*dto.Book, len(books))
+	for i := range books {
+		refs[i] = &books[i]
+	}
+	return books, ctl.withAuthors(ctx, expand, refs...)
+}
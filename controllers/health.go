@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"users-books-api-testing/lib/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// readinessTimeout bounds all the checks of one readiness probe.
+const readinessTimeout = 2 * time.Second
+
+// Health answers the orchestrator's liveness and readiness probes.
+type Health struct {
+	checks  []health.Check
+	started time.Time
+}
+
+func NewHealth(checks ...health.Check) *Health {
+	return &Health{checks: checks, started: time.Now()}
+}
+
+// LivenessController answers as long as the process can serve requests.
+func (h *Health) LivenessController(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+// ReadinessController runs every check and answers 503 if any of them
+// fails, so no traffic is routed here until they all pass.
+func (h *Health) ReadinessController(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readinessTimeout)
+	defer cancel()
+
+	status, code := "ready", http.StatusOK
+	checks := map[string]string{}
+	for _, check := range h.checks {
+		if e := check.Run(ctx); e != nil {
+			checks[check.Name] = e.Error()
+			status, code = "unavailable", http.StatusServiceUnavailable
+			continue
+		}
+		checks[check.Name] = "ok"
+	}
+	return c.JSON(code, map[string]interface{}{
+		"status":         status,
+		"checks":         checks,
+		"version":        health.Version,
+		"uptime_seconds": int64(time.Since(h.started).Seconds()),
+	})
+}
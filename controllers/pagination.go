@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"users-books-api-testing/lib/apierror"
+	"users-books-api-testing/lib/database"
+
+	"github.com/labstack/echo/v4"
+)
+
+// listOptions reads the limit, offset, cursor and sort query parameters.
+func listOptions(c echo.Context) (database.ListOptions, error) {
+	opts := database.ListOptions{
+		Cursor: c.QueryParam("cursor"),
+		Sort:   c.QueryParam("sort"),
+	}
+
+	var err error
+	if opts.Limit, err = intQueryParam(c, "limit"); err != nil {
+		return opts, err
+	}
+	if opts.Offset, err = intQueryParam(c, "offset"); err != nil {
+		return opts, err
+	}
+	// the next page link is built from these, so they are checked here and
+	// not only by the repositories
+	if opts.Limit < 0 {
+		return opts, fmt.Errorf("%w: limit must not be negative", database.ErrInvalidListOptions)
+	}
+	if opts.Offset < 0 {
+		return opts, fmt.Errorf("%w: offset must not be negative", database.ErrInvalidListOptions)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = database.DefaultLimit
+	}
+	if opts.Limit > database.MaxLimit {
+		opts.Limit = database.MaxLimit
+	}
+	return opts, nil
+}
+
+func intQueryParam(c echo.Context, name string) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, apierror.New(http.StatusBadRequest, fmt.Sprintf("%s must be an integer", name))
+	}
+	return n, nil
+}
+
+// pageLinks describes page for the response, with a link to the next page
+// that keeps the filters of the current request. The link continues in the
+// same mode, offset or cursor, that the client is using.
+func pageLinks(c echo.Context, opts database.ListOptions, page database.Page) map[string]interface{} {
+	links := map[string]interface{}{
+		"total":       page.Total,
+		"limit":       opts.Limit,
+		"next_cursor": page.NextCursor,
+	}
+	if opts.Cursor == "" {
+		links["offset"] = opts.Offset
+	}
+	if page.NextCursor == "" {
+		links["next"] = nil
+		return links
+	}
+
+	query := url.Values{}
+	for key, values := range c.QueryParams() {
+		query[key] = values
+	}
+	query.Set("limit", strconv.Itoa(opts.Limit))
+	if opts.Cursor != "" {
+		query.Set("cursor", page.NextCursor)
+	} else {
+		query.Set("offset", strconv.Itoa(opts.Offset+opts.Limit))
+	}
+	links["next"] = c.Request().URL.Path + "?" + query.Encode()
+	return links
+}
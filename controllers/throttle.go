@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"users-books-api-testing/config"
+	"users-books-api-testing/lib/apierror"
+	"users-books-api-testing/lib/logging"
+	"users-books-api-testing/lib/ratelimit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// loginThrottle slows down credential guessing on /login: attempts are
+// limited per client IP and per email, and an email is locked out after too
+// many failed attempts in a row, whether or not an account has it.
+type loginThrottle struct {
+	byIP    *ratelimit.Limiter
+	byEmail *ratelimit.Limiter
+	lockout *ratelimit.Lockout
+}
+
+// newLoginThrottle returns a throttle that tells the time with now.
+func newLoginThrottle(cfg config.LoginThrottle, now ratelimit.Clock) *loginThrottle {
+	store := ratelimit.NewMemoryStore()
+	store.SetClock(now)
+	t := &loginThrottle{
+		byIP:    ratelimit.NewLimiter(store, "ip:", ratelimit.Rule{Limit: cfg.IPLimit, Window: cfg.IPWindow}),
+		byEmail: ratelimit.NewLimiter(store, "email:", ratelimit.Rule{Limit: cfg.EmailLimit, Window: cfg.EmailWindow}),
+		lockout: ratelimit.NewLockout(cfg.LockoutThreshold, cfg.LockoutDuration, cfg.LockoutMaxDuration),
+	}
+	t.byIP.SetClock(now)
+	t.byEmail.SetClock(now)
+	t.lockout.SetClock(now)
+	return t
+}
+
+// allow counts a login attempt for email from the request's client and
+// answers 429 if it goes over a limit or the email is locked out.
+func (t *loginThrottle) allow(c echo.Context, email string) error {
+	if ok, wait := t.byIP.Allow(c.RealIP()); !ok {
+		return tooManyRequests(c, wait, "too many login attempts from this address")
+	}
+	if wait := t.lockout.Locked(email); wait > 0 {
+		return tooManyRequests(c, wait, "this account is locked after too many failed logins")
+	}
+	if ok, wait := t.byEmail.Allow(email); !ok {
+		return tooManyRequests(c, wait, "too many login attempts for this account")
+	}
+	return nil
+}
+
+// failed records wrong credentials for email.
+func (t *loginThrottle) failed(ctx context.Context, email, ip string) {
+	if locked := t.lockout.Fail(email); locked > 0 {
+		logging.FromContext(ctx).Warn().
+			Str("email", email).
+			Str("remote_ip", ip).
+			Dur("locked_for", locked).
+			Msg("account locked after repeated failed logins")
+	}
+}
+
+// succeeded clears the failures recorded for email.
+func (t *loginThrottle) succeeded(email string) {
+	t.lockout.Succeed(email)
+}
+
+// unlock lifts the lockout on email along with its attempt limit.
+func (t *loginThrottle) unlock(email string) {
+	t.lockout.Unlock(email)
+	t.byEmail.Reset(email)
+}
+
+// tooManyRequests answers 429, telling the client in Retry-After how many
+// seconds to wait.
+func tooManyRequests(c echo.Context, wait time.Duration, message string) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	return apierror.New(http.StatusTooManyRequests, message)
+}
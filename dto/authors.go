@@ -0,0 +1,55 @@
+package dto
+
+import (
+	"time"
+	"users-books-api-testing/models"
+)
+
+// Author is an author as clients see it.
+type Author struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version is what the author's ETag is made of.
+	Version uint `json:"version"`
+}
+
+func NewAuthor(author models.Authors) Author {
+	return Author{
+		ID:        author.ID,
+		Name:      author.Name,
+		CreatedAt: author.CreatedAt,
+		UpdatedAt: author.UpdatedAt,
+		Version:   author.Version,
+	}
+}
+
+func NewAuthors(authors []models.Authors) []Author {
+	out := make([]Author, len(authors))
+	for i, author := range authors {
+		out[i] = NewAuthor(author)
+	}
+	return out
+}
+
+// CreateAuthorRequest is the body of POST /jwt/authors.
+type CreateAuthorRequest struct {
+	Name string `json:"name" form:"name" validate:"required,max=255"`
+}
+
+func (r CreateAuthorRequest) Model() models.Authors {
+	return models.Authors{Name: r.Name}
+}
+
+// UpdateAuthorRequest is the body of PUT /jwt/authors/:id. Renaming an
+// author rewrites the bylines of their books.
+type UpdateAuthorRequest struct {
+	Name string `json:"name" form:"name" validate:"required,max=255"`
+}
+
+// Apply returns author with the name in the request.
+func (r UpdateAuthorRequest) Apply(author models.Authors) models.Authors {
+	author.Name = r.Name
+	return author
+}
@@ -0,0 +1,147 @@
+package dto
+
+import (
+	"time"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/models"
+)
+
+// Book is a book as clients see it.
+type Book struct {
+	ID     uint   `json:"id"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	Year   int    `json:"year"`
+	// UserID is the owner; zero for books added before ownership existed.
+	UserID uint `json:"user_id"`
+	// Copies is how many of the book there are to lend.
+	Copies    int       `json:"copies"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is only set on deleted books, which only admins get to see.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Version is what the book's ETag is made of.
+	Version uint `json:"version"`
+	// Authors is only there when the request asks for it with
+	// ?expand=authors.
+	Authors *[]Author `json:"authors,omitempty"`
+}
+
+func NewBook(book models.Books) Book {
+	return Book{
+		ID:        book.ID,
+		Title:     book.Title,
+		Author:    book.Author,
+		Year:      book.Year,
+		UserID:    book.UserID,
+		Copies:    book.Copies,
+		CreatedAt: book.CreatedAt,
+		UpdatedAt: book.UpdatedAt,
+		DeletedAt: deletedAt(book.Model),
+		Version:   book.Version,
+	}
+}
+
+// WithAuthors returns book with its authors expanded.
+func (b Book) WithAuthors(authors []models.Authors) Book {
+	expanded := NewAuthors(authors)
+	b.Authors = &expanded
+	return b
+}
+
+func NewBooks(books []models.Books) []Book {
+	out := make([]Book, len(books))
+	for i, book := range books {
+		out[i] = NewBook(book)
+	}
+	return out
+}
+
+// CreateBookRequest is the body of POST /jwt/books. The owner is the user
+// whose token adds the book.
+type CreateBookRequest struct {
+	Title string `json:"title" form:"title" validate:"required,max=255"`
+	// Author is the name of the book's one author, who is added if there is
+	// no author by that name yet. AuthorIDs wins over it.
+	Author string `json:"author" form:"author" validate:"required_without=AuthorIDs,max=255"`
+	// AuthorIDs are the ids of the book's authors, in byline order.
+	AuthorIDs []uint `json:"author_ids" form:"author_ids" validate:"omitempty,max=20"`
+	Year      int    `json:"year" form:"year" validate:"required,year"`
+	// Copies defaults to one.
+	Copies int `json:"copies" form:"copies" validate:"omitempty,min=1"`
+}
+
+func (r CreateBookRequest) Model() models.Books {
+	return models.Books{Title: r.Title, Author: r.Author, AuthorIDs: r.AuthorIDs, Year: r.Year, Copies: r.Copies}
+}
+
+// UpdateBookRequest is the body of PUT /jwt/books/:id. Fields left out keep
+// their value, and ownership can't be handed over. The authors change with
+// AuthorIDs, an empty list included, or with Author as on creation.
+type UpdateBookRequest struct {
+	Title     string `json:"title" form:"title" validate:"omitempty,max=255"`
+	Author    string `json:"author" form:"author" validate:"omitempty,max=255"`
+	AuthorIDs []uint `json:"author_ids" form:"author_ids" validate:"omitempty,max=20"`
+	Year      int    `json:"year" form:"year" validate:"omitempty,year"`
+	Copies    int    `json:"copies" form:"copies" validate:"omitempty,min=1"`
+}
+
+// Apply returns book with the fields set in the request replaced.
+func (r UpdateBookRequest) Apply(book models.Books) models.Books {
+	if r.Title != "" {
+		book.Title = r.Title
+	}
+	if r.Author != "" {
+		book.Author = r.Author
+	}
+	if r.AuthorIDs != nil {
+		book.AuthorIDs = r.AuthorIDs
+	}
+	if r.Year != 0 {
+		book.Year = r.Year
+	}
+	if r.Copies != 0 {
+		book.Copies = r.Copies
+	}
+	return book
+}
+
+// PatchBookRequest is what the JSON Merge Patch sent to PATCH /jwt/books/:id
+// applies to: the book's current values, so members left out keep them and
+// members set to null clear them. Only the title and copies can't be
+// cleared. The author ids aren't among them; patching them in replaces the
+// authors.
+type PatchBookRequest struct {
+	Title     string `json:"title" validate:"required,max=255"`
+	Author    string `json:"author" validate:"max=255"`
+	AuthorIDs []uint `json:"author_ids,omitempty" validate:"max=20"`
+	Year      int    `json:"year" validate:"omitempty,year"`
+	Copies    int    `json:"copies" validate:"min=1"`
+}
+
+func NewPatchBookRequest(book models.Books) PatchBookRequest {
+	return PatchBookRequest{Title: book.Title, Author: book.Author, Year: book.Year, Copies: book.Copies}
+}
+
+// Apply returns book with the patched values.
+func (r PatchBookRequest) Apply(book models.Books) models.Books {
+	book.Title, book.Author, book.AuthorIDs, book.Year, book.Copies = r.Title, r.Author, r.AuthorIDs, r.Year, r.Copies
+	return book
+}
+
+// BookSearchResult is a book found by GET /jwt/books/search.
+type BookSearchResult struct {
+	Book  Book    `json:"book"`
+	Score float64 `json:"score"`
+	// Highlights has the fields that matched, HTML escaped, with the
+	// matching words in <em> tags.
+	Highlights map[string]string `json:"highlights"`
+}
+
+func NewBookSearchResults(hits []database.BookHit) []BookSearchResult {
+	out := make([]BookSearchResult, len(hits))
+	for i, hit := range hits {
+		out[i] = BookSearchResult{Book: NewBook(hit.Book), Score: hit.Score, Highlights: hit.Highlights}
+	}
+	return out
+}
@@ -0,0 +1,19 @@
+// Package dto holds what the API reads from and writes to clients. Handlers
+// bind requests into the request types, which only carry the fields clients
+// may set, and answer with the response types, so the models in package
+// models are never serialized as they are.
+package dto
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func deletedAt(model gorm.Model) *time.Time {
+	if !model.DeletedAt.Valid {
+		return nil
+	}
+	t := model.DeletedAt.Time
+	return &t
+}
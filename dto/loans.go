@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"time"
+	"users-books-api-testing/models"
+)
+
+// Loan is a loan as clients see it.
+type Loan struct {
+	ID     uint      `json:"id"`
+	BookID uint      `json:"book_id"`
+	UserID uint      `json:"user_id"`
+	DueAt  time.Time `json:"due_at"`
+	// ReturnedAt is null while the book is out.
+	ReturnedAt *time.Time `json:"returned_at"`
+	// Overdue is set on loans still out past their due date.
+	Overdue   bool      `json:"overdue"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewLoan(loan models.Loans) Loan {
+	return Loan{
+		ID:         loan.ID,
+		BookID:     loan.BookID,
+		UserID:     loan.UserID,
+		DueAt:      loan.DueAt,
+		ReturnedAt: loan.ReturnedAt,
+		Overdue:    loan.Overdue(time.Now()),
+		CreatedAt:  loan.CreatedAt,
+		UpdatedAt:  loan.UpdatedAt,
+	}
+}
+
+func NewLoans(loans []models.Loans) []Loan {
+	out := make([]Loan, len(loans))
+	for i, loan := range loans {
+		out[i] = NewLoan(loan)
+	}
+	return out
+}
+
+// CreateLoanRequest is the body of POST /jwt/loans, which checks a copy of
+// a book out.
+type CreateLoanRequest struct {
+	BookID uint `json:"book_id" form:"book_id" validate:"required"`
+	// UserID is who borrows the book, the user whose token checks it out
+	// if left out. Only admins can lend to someone else.
+	UserID uint `json:"user_id" form:"user_id"`
+	// DueAt defaults to the loan period from now.
+	DueAt *time.Time `json:"due_at" form:"due_at"`
+}
+
+// Model returns the loan to check out, to userID if the request doesn't
+// name the borrower and due after period if it doesn't say when.
+func (r CreateLoanRequest) Model(userID uint, period time.Duration) models.Loans {
+	loan := models.Loans{BookID: r.BookID, UserID: r.UserID, DueAt: time.Now().Add(period)}
+	if loan.UserID == 0 {
+		loan.UserID = userID
+	}
+	if r.DueAt != nil {
+		loan.DueAt = *r.DueAt
+	}
+	return loan
+}
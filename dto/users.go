@@ -0,0 +1,109 @@
+package dto
+
+import (
+	"time"
+	"users-books-api-testing/models"
+)
+
+// User is a user as clients see it: never with the password hash or the
+// stored access token.
+type User struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is only set on deleted users, which only admins get to see.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Version is what the user's ETag is made of.
+	Version uint `json:"version"`
+}
+
+func NewUser(user models.Users) User {
+	return User{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		DeletedAt: deletedAt(user.Model),
+		Version:   user.Version,
+	}
+}
+
+func NewUsers(users []models.Users) []User {
+	out := make([]User, len(users))
+	for i, user := range users {
+		out[i] = NewUser(user)
+	}
+	return out
+}
+
+// CreateUserRequest is the body of POST /users.
+type CreateUserRequest struct {
+	Name     string `json:"name" form:"name" validate:"required,max=100"`
+	Email    string `json:"email" form:"email" validate:"required,email,max=191"`
+	Password string `json:"password" form:"password" validate:"required,password"`
+}
+
+func (r CreateUserRequest) Model() models.Users {
+	return models.Users{Name: r.Name, Email: r.Email, Password: r.Password}
+}
+
+// UpdateUserRequest is the body of PUT /jwt/users/:id. Fields left out keep
+// their value.
+type UpdateUserRequest struct {
+	Name     string `json:"name" form:"name" validate:"omitempty,max=100"`
+	Email    string `json:"email" form:"email" validate:"omitempty,email,max=191"`
+	Password string `json:"password" form:"password" validate:"omitempty,password"`
+	// Role can only be changed by admins.
+	Role string `json:"role" form:"role" validate:"omitempty,oneof=admin member"`
+}
+
+// Apply returns user with the fields set in the request replaced.
+func (r UpdateUserRequest) Apply(user models.Users) models.Users {
+	if r.Name != "" {
+		user.Name = r.Name
+	}
+	if r.Email != "" {
+		user.Email = r.Email
+	}
+	user.Password = r.Password
+	if r.Role != "" {
+		user.Role = r.Role
+	}
+	return user
+}
+
+// PatchUserRequest is what the JSON Merge Patch sent to PATCH
+// /jwt/users/:id applies to: the user's current values, so members left out
+// keep them. The password isn't among them; patching one in sets it.
+type PatchUserRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,email,max=191"`
+	Password string `json:"password,omitempty" validate:"omitempty,password"`
+	// Role can only be changed by admins.
+	Role string `json:"role" validate:"required,oneof=admin member"`
+}
+
+func NewPatchUserRequest(user models.Users) PatchUserRequest {
+	return PatchUserRequest{Name: user.Name, Email: user.Email, Role: user.Role}
+}
+
+// Apply returns user with the patched values.
+func (r PatchUserRequest) Apply(user models.Users) models.Users {
+	user.Name, user.Email, user.Password, user.Role = r.Name, r.Email, r.Password, r.Role
+	return user
+}
+
+// LoginRequest is the body of POST /login.
+type LoginRequest struct {
+	Email    string `json:"email" form:"email" validate:"required"`
+	Password string `json:"password" form:"password" validate:"required"`
+}
+
+func (r LoginRequest) Model() models.Users {
+	return models.Users{Email: r.Email, Password: r.Password}
+}
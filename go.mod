@@ -3,10 +3,17 @@ module users-books-api-testing
 go 1.16
 
 require (
-	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
+	github.com/go-playground/validator/v10 v10.9.0
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/joho/godotenv v1.3.0
-	github.com/labstack/echo/v4 v4.5.0 // indirect
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/labstack/echo/v4 v4.5.0
+	github.com/mattn/go-sqlite3 v1.14.5
+	github.com/prometheus/client_golang v1.11.0
+	github.com/rs/zerolog v1.26.1
+	github.com/stretchr/testify v1.7.0
+	golang.org/x/crypto v0.0.0-20211215165025-cf75a172585e
 	gorm.io/driver/mysql v1.1.2
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.14
 )
@@ -0,0 +1,137 @@
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"users-books-api-testing/lib/validation"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Error is an error that knows how it is presented to API clients. Err, the
+// underlying cause, is logged but never sent to the client.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Err     error
+}
+
+func New(status int, message string) *Error {
+	return &Error{Status: status, Code: CodeFor(status), Message: message}
+}
+
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var codes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "validation_failed",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "service_unavailable",
+}
+
+// CodeFor returns the machine readable code clients see for status.
+func CodeFor(status int) string {
+	if code, ok := codes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[error]int{}
+)
+
+// Register makes From answer with status, and the error's own message, for
+// any error that wraps target. Only register errors whose messages, including
+// whatever they get wrapped with, are fit for clients.
+func Register(target error, status int) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[target] = status
+}
+
+// From turns any error returned by a handler or middleware into an Error.
+// Errors it doesn't recognise become a 500 that hides the cause.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fromHTTPError(httpErr)
+	}
+
+	var invalid validation.Errors
+	if errors.As(err, &invalid) {
+		return New(http.StatusUnprocessableEntity, "validation failed").WithDetails(invalid).Wrap(err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return New(http.StatusServiceUnavailable, "the request timed out").Wrap(err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return New(http.StatusServiceUnavailable, "the request was canceled").Wrap(err)
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for target, status := range registry {
+		if errors.Is(err, target) {
+			return New(status, err.Error())
+		}
+	}
+
+	return New(http.StatusInternalServerError, "internal server error").Wrap(err)
+}
+
+func fromHTTPError(he *echo.HTTPError) *Error {
+	e := New(he.Code, http.StatusText(he.Code)).Wrap(he.Internal)
+	switch m := he.Message.(type) {
+	case string:
+		e.Message = m
+	case error:
+		e.Message = m.Error()
+	case map[string]interface{}:
+		if msg, ok := m["message"].(string); ok {
+			e.Message = msg
+		}
+	}
+	return e
+}
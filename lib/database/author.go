@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users-books-api-testing/models"
+
+	"gorm.io/gorm"
+)
+
+type gormAuthorRepository struct {
+	db *gorm.DB
+}
+
+func NewGormAuthorRepository(db *gorm.DB) AuthorRepository {
+	return &gormAuthorRepository{db: db}
+}
+
+func (r *gormAuthorRepository) CreateAuthor(ctx context.Context, author *models.Authors) error {
+	author.Name = strings.TrimSpace(author.Name)
+	author.Version = 1
+	if err := r.db.WithContext(ctx).Table("authors").Create(author).Error; err != nil {
+		return translate(err)
+	}
+	return nil
+}
+
+func (r *gormAuthorRepository) GetAuthors(ctx context.Context, filter AuthorFilter, opts ListOptions) ([]models.Authors, Page, error) {
+	q, err := newListQuery(opts, authorSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	var total int64
+	if err := r.filtered(ctx, filter).Count(&total).Error; err != nil {
+		return nil, Page{}, err
+	}
+
+	var authors []models.Authors
+	if err := q.apply(r.filtered(ctx, filter)).Find(&authors).Error; err != nil {
+		return nil, Page{}, err
+	}
+	n, page := q.page(total, len(authors), func(i int) uint { return authors[i].ID }, func(i int, column string) interface{} {
+		return authorSortValue(authors[i], column)
+	})
+	return authors[:n], page, nil
+}
+
+func (r *gormAuthorRepository) filtered(ctx context.Context, filter AuthorFilter) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&models.Authors{})
+	if filter.Name != "" {
+		db = db.Where("name LIKE ? ESCAPE '!'", likeContains(filter.Name))
+	}
+	return db
+}
+
+func (r *gormAuthorRepository) GetAuthorById(ctx context.Context, id int) (models.Authors, error) {
+	var author models.Authors
+	if err := r.db.WithContext(ctx).Table("authors").First(&author, id).Error; err != nil {
+		return models.Authors{}, translate(err)
+	}
+	return author, nil
+}
+
+func (r *gormAuthorRepository) UpdateAuthorById(ctx context.Context, id int, author *models.Authors) error {
+	author.Name = strings.TrimSpace(author.Name)
+	read := author.Version
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := update(tx, "authors", id, author, &author.Version, "name"); err != nil {
+			return err
+		}
+		return rewriteBylines(tx, uint(id))
+	})
+	if err != nil {
+		author.Version = read
+	}
+	return err
+}
+
+func (r *gormAuthorRepository) DeleteAuthorById(ctx context.Context, id int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var books int64
+		err := tx.Table("book_authors").
+			Joins("JOIN books ON books.id = book_authors.book_id AND books.deleted_at IS NULL").
+			Where("book_authors.author_id = ?", id).Count(&books).Error
+		if err != nil {
+			return err
+		}
+		if books > 0 {
+			return ErrAuthorHasBooks
+		}
+		return tx.Table("authors").Where("id = ?", id).Delete(&models.Authors{}).Error
+	})
+}
+
+func (r *gormAuthorRepository) GetAuthorsOfBooks(ctx context.Context, bookIDs []uint) (map[uint][]models.Authors, error) {
+	found := map[uint][]models.Authors{}
+	if len(bookIDs) == 0 {
+		return found, nil
+	}
+	db := r.db.WithContext(ctx)
+	links, authors, err := gormLinks(db, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		if author, ok := authors[link.AuthorID]; ok && !author.DeletedAt.Valid {
+			found[link.BookID] = append(found[link.BookID], author)
+		}
+	}
+	return found, nil
+}
+
+// gormLinks returns the links of the books with bookIDs, in byline order, and
+// the authors they link to, deleted or not.
+func gormLinks(db *gorm.DB, bookIDs []uint) ([]models.BookAuthors, map[uint]models.Authors, error) {
+	var links []models.BookAuthors
+	if err := db.Table("book_authors").Where("book_id IN ?", bookIDs).Order("book_id, position").Find(&links).Error; err != nil {
+		return nil, nil, err
+	}
+	ids := make([]uint, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.AuthorID)
+	}
+	var rows []models.Authors
+	if len(ids) > 0 {
+		if err := db.Unscoped().Table("authors").Where("id IN ?", ids).Find(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	authors := make(map[uint]models.Authors, len(rows))
+	for _, author := range rows {
+		authors[author.ID] = author
+	}
+	return links, authors, nil
+}
+
+// rewriteBylines sets the byline of every book by the author with id, deleted
+// or not, from the names of its authors.
+func rewriteBylines(tx *gorm.DB, id uint) error {
+	var bookIDs []uint
+	if err := tx.Table("book_authors").Where("author_id = ?", id).Pluck("book_id", &bookIDs).Error; err != nil {
+		return err
+	}
+	if len(bookIDs) == 0 {
+		return nil
+	}
+	links, authors, err := gormLinks(tx, bookIDs)
+	if err != nil {
+		return err
+	}
+	byBook := map[uint][]models.Authors{}
+	for _, link := range links {
+		byBook[link.BookID] = append(byBook[link.BookID], authors[link.AuthorID])
+	}
+	for _, bookID := range bookIDs {
+		err := tx.Table("books").Where("id = ?", bookID).Updates(map[string]interface{}{
+			"author":     byline(byBook[bookID]),
+			"updated_at": time.Now(),
+			"version":    gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gormBookAuthors returns the authors book is to be linked to, as described
+// at BookRepository, and sets its Author to match.
+func gormBookAuthors(tx *gorm.DB, book *models.Books) ([]models.Authors, error) {
+	if book.AuthorIDs == nil {
+		name := strings.TrimSpace(book.Author)
+		if name == "" {
+			return nil, nil
+		}
+		var author models.Authors
+		err := tx.Table("authors").Where("name = ?", name).Order("id").First(&author).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			author = models.Authors{Name: name, Version: 1}
+			err = tx.Table("authors").Create(&author).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+		book.Author = name
+		return []models.Authors{author}, nil
+	}
+
+	var found []models.Authors
+	if len(book.AuthorIDs) > 0 {
+		if err := tx.Table("authors").Where("id IN ?", book.AuthorIDs).Find(&found).Error; err != nil {
+			return nil, err
+		}
+	}
+	authors, err := orderAuthors(book.AuthorIDs, found)
+	if err != nil {
+		return nil, err
+	}
+	book.Author = byline(authors)
+	return authors, nil
+}
+
+func linkAuthors(tx *gorm.DB, bookID uint, authors []models.Authors) error {
+	if len(authors) == 0 {
+		return nil
+	}
+	links := make([]models.BookAuthors, len(authors))
+	for i, author := range authors {
+		links[i] = models.BookAuthors{BookID: bookID, AuthorID: author.ID, Position: i}
+	}
+	return tx.Table("book_authors").Create(&links).Error
+}
+
+// orderAuthors returns the authors in found in the order of ids, leaving out
+// repeated ids, or ErrUnknownAuthor if one isn't in found.
+func orderAuthors(ids []uint, found []models.Authors) ([]models.Authors, error) {
+	byID := make(map[uint]models.Authors, len(found))
+	for _, author := range found {
+		byID[author.ID] = author
+	}
+	authors := make([]models.Authors, 0, len(ids))
+	seen := map[uint]bool{}
+	for _, id := range ids {
+		author, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownAuthor, id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			authors = append(authors, author)
+		}
+	}
+	return authors, nil
+}
+
+// byline is what a book by authors has for its Author.
+func byline(authors []models.Authors) string {
+	names := make([]string, len(authors))
+	for i, author := range authors {
+		names[i] = author.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func matchAuthor(author models.Authors, filter AuthorFilter) bool {
+	return filter.Name == "" || containsFold(author.Name, filter.Name)
+}
+
+func authorSortValue(author models.Authors, column string) interface{} {
+	switch column {
+	case "name":
+		return author.Name
+	case "created_at":
+		return author.CreatedAt
+	default:
+		return int(author.ID)
+	}
+}
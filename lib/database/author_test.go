@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBooksAreLinkedToAuthors(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		names := func(bookID uint) []string {
+			found, err := store.Authors.GetAuthorsOfBooks(ctx, []uint{bookID})
+			require.NoError(t, err, name)
+			out := []string{}
+			for _, author := range found[bookID] {
+				out = append(out, author.Name)
+			}
+			return out
+		}
+
+		// a byline alone finds or adds the author with that name
+		dune := models.Books{Title: "Dune", Author: " Frank Herbert ", Year: 1965}
+		require.NoError(t, store.Books.AddBook(ctx, &dune), name)
+		messiah := models.Books{Title: "Dune Messiah", Author: "Frank Herbert", Year: 1969}
+		require.NoError(t, store.Books.AddBook(ctx, &messiah), name)
+		assert.Equal(t, "Frank Herbert", dune.Author, name)
+		authors, page, err := store.Authors.GetAuthors(ctx, AuthorFilter{}, ListOptions{})
+		require.NoError(t, err, name)
+		require.Len(t, authors, 1, name)
+		assert.Equal(t, int64(1), page.Total, name)
+		frank := authors[0]
+		assert.Equal(t, []string{"Frank Herbert"}, names(messiah.ID), name)
+
+		// author ids decide the byline, in their order
+		brian := models.Authors{Name: "Brian Herbert"}
+		require.NoError(t, store.Authors.CreateAuthor(ctx, &brian), name)
+		sequel := models.Books{Title: "Hunters of Dune", Author: "ignored", AuthorIDs: []uint{brian.ID, frank.ID, brian.ID}}
+		require.NoError(t, store.Books.AddBook(ctx, &sequel), name)
+		assert.Equal(t, "Brian Herbert, Frank Herbert", sequel.Author, name)
+		assert.Equal(t, []string{"Brian Herbert", "Frank Herbert"}, names(sequel.ID), name)
+		assert.ErrorIs(t, store.Books.AddBook(ctx, &models.Books{Title: "x", AuthorIDs: []uint{999}}), ErrUnknownAuthor, name)
+
+		byFrank, _, err := store.Books.GetBooks(ctx, BookFilter{AuthorID: frank.ID}, ListOptions{})
+		require.NoError(t, err, name)
+		assert.Len(t, byFrank, 3, name)
+
+		// updates leave the authors alone unless the byline or ids change
+		stored, err := store.Books.GetBookById(ctx, int(sequel.ID))
+		require.NoError(t, err, name)
+		stored.Title = "Sandworms of Dune"
+		require.NoError(t, store.Books.UpdateBookById(ctx, int(sequel.ID), &stored), name)
+		assert.Equal(t, []string{"Brian Herbert", "Frank Herbert"}, names(sequel.ID), name)
+		stored.Author = "Kevin J. Anderson"
+		require.NoError(t, store.Books.UpdateBookById(ctx, int(sequel.ID), &stored), name)
+		assert.Equal(t, []string{"Kevin J. Anderson"}, names(sequel.ID), name)
+		stored.AuthorIDs = []uint{}
+		require.NoError(t, store.Books.UpdateBookById(ctx, int(sequel.ID), &stored), name)
+		assert.Equal(t, []string{}, names(sequel.ID), name)
+		assert.Equal(t, "", stored.Author, name)
+
+		// renaming rewrites the bylines, deleting waits for the books to go
+		frank.Name = "Franklin Herbert"
+		require.NoError(t, store.Authors.UpdateAuthorById(ctx, int(frank.ID), &frank), name)
+		stored, err = store.Books.GetBookById(ctx, int(dune.ID))
+		require.NoError(t, err, name)
+		assert.Equal(t, "Franklin Herbert", stored.Author, name)
+		assert.Equal(t, uint(2), stored.Version, name)
+		frank.Version = 1
+		assert.ErrorIs(t, store.Authors.UpdateAuthorById(ctx, int(frank.ID), &frank), ErrStaleVersion, name)
+
+		assert.ErrorIs(t, store.Authors.DeleteAuthorById(ctx, int(frank.ID)), ErrAuthorHasBooks, name)
+		require.NoError(t, store.Books.DeleteBookById(ctx, int(dune.ID)), name)
+		require.NoError(t, store.Books.DeleteBookById(ctx, int(messiah.ID)), name)
+		require.NoError(t, store.Authors.DeleteAuthorById(ctx, int(frank.ID)), name)
+		_, err = store.Authors.GetAuthorById(ctx, int(frank.ID))
+		assert.ErrorIs(t, err, ErrNotFound, name)
+		assert.Equal(t, []string{}, names(dune.ID), name, "deleted authors aren't listed")
+	}
+}
@@ -1,51 +1,257 @@
 package database
 
 import (
-	"users-books-api-testing/config"
+	"context"
+	"strings"
+	"time"
 	"users-books-api-testing/models"
+
+	"gorm.io/gorm"
 )
 
-func AddBook(book *models.Books) error {
-	if err := config.DB.Table("books").Create(&book).Error; err != nil {
-		return err
+type gormBookRepository struct {
+	db *gorm.DB
+}
+
+func NewGormBookRepository(db *gorm.DB) BookRepository {
+	return &gormBookRepository{db: db}
+}
+
+func (r *gormBookRepository) AddBook(ctx context.Context, book *models.Books) error {
+	book.Version = 1
+	if book.Copies <= 0 {
+		book.Copies = 1
 	}
-	return nil
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		authors, err := gormBookAuthors(tx, book)
+		if err != nil {
+			return err
+		}
+		if err := tx.Table("books").Create(&book).Error; err != nil {
+			return translate(err)
+		}
+		return linkAuthors(tx, book.ID, authors)
+	})
 }
 
-func GetBooks() (interface{}, error) {
+func (r *gormBookRepository) GetBooks(ctx context.Context, filter BookFilter, opts ListOptions) ([]models.Books, Page, error) {
+	q, err := newListQuery(opts, bookSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	var total int64
+	if err := r.filtered(ctx, filter).Count(&total).Error; err != nil {
+		return nil, Page{}, err
+	}
+
 	var books []models.Books
+	if err := q.apply(r.filtered(ctx, filter)).Find(&books).Error; err != nil {
+		return nil, Page{}, err
+	}
+	n, page := q.page(total, len(books), func(i int) uint { return books[i].ID }, func(i int, column string) interface{} {
+		return bookSortValue(books[i], column)
+	})
+	return books[:n], page, nil
+}
 
-	if err := config.DB.Table("books").Find(&books).Error; err != nil {
-		return nil, err
+func (r *gormBookRepository) filtered(ctx context.Context, filter BookFilter) *gorm.DB {
+	db := r.db.WithContext(ctx).Table("books")
+	if filter.IncludeDeleted {
+		db = db.Unscoped()
 	}
-	return books, nil
+	if filter.Author != "" {
+		db = db.Where("LOWER(author) = LOWER(?)", filter.Author)
+	}
+	if filter.AuthorID != 0 {
+		db = db.Where("id IN (?)", r.db.Table("book_authors").Select("book_id").Where("author_id = ?", filter.AuthorID))
+	}
+	if filter.Title != "" {
+		db = db.Where("title LIKE ? ESCAPE '!'", likeContains(filter.Title))
+	}
+	if filter.YearFrom != 0 {
+		db = db.Where("year >= ?", filter.YearFrom)
+	}
+	if filter.YearTo != 0 {
+		db = db.Where("year <= ?", filter.YearTo)
+	}
+	return db
 }
 
-func GetBookById(id int) (interface{}, error) {
+func (r *gormBookRepository) GetBookById(ctx context.Context, id int) (models.Books, error) {
 	var book models.Books
 
-	if err := config.DB.Table("books").First(&book, id).Error; err != nil {
-		return nil, err
+	if err := r.db.WithContext(ctx).Table("books").First(&book, id).Error; err != nil {
+		return models.Books{}, translate(err)
 	}
 	return book, nil
 }
 
-func UpdateBookById(id int, book *models.Books) error {
-	var books models.Books
-	if err := config.DB.Table("books").First(&books, id).Error; err != nil {
-		return err
+// idsPerQuery keeps the placeholders of an id IN (...) query well under
+// what SQLite and MySQL take.
+const idsPerQuery = 1000
+
+func (r *gormBookRepository) GetBooksByIds(ctx context.Context, ids []uint) ([]models.Books, error) {
+	books := []models.Books{}
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > idsPerQuery {
+			n = idsPerQuery
+		}
+		var found []models.Books
+		if err := r.db.WithContext(ctx).Table("books").Where("id IN ?", ids[:n]).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		books = append(books, found...)
+		ids = ids[n:]
 	}
-	err := config.DB.Table("books").Where("id = ?", id).Updates(book).Error
-	if err != nil {
+	return books, nil
+}
+
+func (r *gormBookRepository) GetBooksByUserId(ctx context.Context, userId int) ([]models.Books, error) {
+	var books []models.Books
+
+	if err := r.db.WithContext(ctx).Table("books").Where("user_id = ?", userId).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (r *gormBookRepository) UpdateBookById(ctx context.Context, id int, book *models.Books) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		relink := book.AuthorIDs != nil
+		if !relink {
+			var stored models.Books
+			if err := tx.Table("books").Select("author").First(&stored, id).Error; err != nil {
+				return translate(err)
+			}
+			relink = stored.Author != book.Author
+		}
+
+		var authors []models.Authors
+		if relink {
+			var err error
+			if authors, err = gormBookAuthors(tx, book); err != nil {
+				return err
+			}
+		}
+		if err := update(tx, "books", id, book, &book.Version, "title", "author", "year", "copies"); err != nil {
+			return translate(err)
+		}
+		if !relink {
+			return nil
+		}
+		if err := tx.Table("book_authors").Where("book_id = ?", id).Delete(&models.BookAuthors{}).Error; err != nil {
+			return err
+		}
+		return linkAuthors(tx, uint(id), authors)
+	})
+}
+
+func (r *gormBookRepository) DeleteBookById(ctx context.Context, id int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// write the book's row first, as CheckOutBook does, so a checkout
+		// can't slip in between the count and the delete
+		if err := tx.Table("books").Where("id = ?", id).Update("copies", gorm.Expr("copies")).Error; err != nil {
+			return err
+		}
+		var out int64
+		if err := tx.Table("loans").Where("book_id = ? AND returned_at IS NULL", id).Count(&out).Error; err != nil {
+			return err
+		}
+		if out > 0 {
+			return ErrBookLentOut
+		}
+		var book models.Books
+		return tx.Table("books").Where("id = ?", id).Delete(&book).Error
+	})
+}
+
+func (r *gormBookRepository) RestoreBookById(ctx context.Context, id int) error {
+	return restore(r.db.WithContext(ctx), "books", id)
+}
+
+func (r *gormBookRepository) PurgeBooks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted := tx.Table("books").Select("id").Where("deleted_at < ?", deletedBefore)
+		if err := tx.Table("book_authors").Where("book_id IN (?)", deleted).Delete(&models.BookAuthors{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("loans").Where("book_id IN (?)", deleted).Delete(&models.Loans{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at < ?", deletedBefore).Delete(&models.Books{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// update writes columns, zero values included, from values to the row of
+// table with id, provided the row is still at *version, which it then moves
+// on by one.
+func update(db *gorm.DB, table string, id int, values interface{}, version *uint, columns ...string) error {
+	read := *version
+	*version = read + 1
+	result := db.Table(table).Where("id = ? AND version = ?", id, read).
+		Select(append(columns, "version")).Updates(values)
+	if result.Error != nil || result.RowsAffected == 1 {
+		return result.Error
+	}
+
+	*version = read
+	var count int64
+	if err := db.Table(table).Where("id = ? AND deleted_at IS NULL", id).Count(&count).Error; err != nil {
 		return err
 	}
-	return nil
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrStaleVersion
 }
 
-func DeleteBookById(id int) error {
-	var book models.Books
-	if err := config.DB.Table("books").Where("id = ?", id).Delete(&book).Error; err != nil {
+// restore clears deleted_at on the row of table with id, which must exist,
+// deleted or not.
+func restore(db *gorm.DB, table string, id int) error {
+	var count int64
+	if err := db.Unscoped().Table(table).Where("id = ?", id).Count(&count).Error; err != nil {
 		return err
 	}
-	return nil
+	if count == 0 {
+		return ErrNotFound
+	}
+	return db.Unscoped().Table(table).Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now(), "version": gorm.Expr("version + 1")}).Error
+}
+
+func matchBook(book models.Books, filter BookFilter) bool {
+	if filter.Author != "" && !strings.EqualFold(book.Author, filter.Author) {
+		return false
+	}
+	if filter.Title != "" && !containsFold(book.Title, filter.Title) {
+		return false
+	}
+	if filter.YearFrom != 0 && book.Year < filter.YearFrom {
+		return false
+	}
+	if filter.YearTo != 0 && book.Year > filter.YearTo {
+		return false
+	}
+	return true
+}
+
+func bookSortValue(book models.Books, column string) interface{} {
+	switch column {
+	case "title":
+		return book.Title
+	case "author":
+		return book.Author
+	case "year":
+		return book.Year
+	case "created_at":
+		return book.CreatedAt
+	default:
+		return int(book.ID)
+	}
 }
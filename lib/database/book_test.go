@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterBooksByAuthor(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		for _, book := range []models.Books{
+			{Title: "Dune", Author: "Frank Herbert", Year: 1965},
+			{Title: "Hyperion", Author: "Dan Simmons", Year: 1989},
+		} {
+			require.NoError(t, store.Books.AddBook(ctx, &book), name)
+		}
+
+		titles := func(author string) []string {
+			books, _, err := store.Books.GetBooks(ctx, BookFilter{Author: author}, ListOptions{})
+			require.NoError(t, err, name)
+			out := []string{}
+			for _, book := range books {
+				out = append(out, book.Title)
+			}
+			return out
+		}
+		assert.Equal(t, []string{"Dune"}, titles("Frank Herbert"), name)
+		assert.Equal(t, []string{"Dune"}, titles("FRANK herbert"), name)
+		assert.Empty(t, titles("Frank"), name, "the whole byline has to match")
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"users-books-api-testing/config"
+	"users-books-api-testing/lib/migrate"
+	"users-books-api-testing/migrations"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newSQLiteStore returns a GORM store on a migrated SQLite database of its
+// own.
+func newSQLiteStore(t *testing.T) (*Store, *gorm.DB) {
+	db, err := config.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	m, err := migrate.New(db, migrations.FS)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+	return NewGormStore(db), db
+}
+
+func TestGormStoreStopsOnDoneContext(t *testing.T) {
+	store, db := newSQLiteStore(t)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	calls := map[string]func(ctx context.Context) error{
+		"CreateUser": func(ctx context.Context) error {
+			return store.Users.CreateUser(ctx, &models.Users{Name: "a", Email: "a@example.com", Password: "a"})
+		},
+		"GetUsers": func(ctx context.Context) error {
+			_, _, err := store.Users.GetUsers(ctx, UserFilter{}, ListOptions{})
+			return err
+		},
+		"GetBookById": func(ctx context.Context) error {
+			_, err := store.Books.GetBookById(ctx, 1)
+			return err
+		},
+		"PurgeBooks": func(ctx context.Context) error {
+			_, err := store.Books.PurgeBooks(ctx, time.Now())
+			return err
+		},
+		"IsAccessTokenRevoked": func(ctx context.Context) error {
+			_, err := store.Tokens.IsAccessTokenRevoked(ctx, "jti")
+			return err
+		},
+	}
+	for name, call := range calls {
+		assert.True(t, errors.Is(call(canceled), context.Canceled), name)
+		assert.True(t, errors.Is(call(expired), context.DeadlineExceeded), name)
+	}
+
+	var count int64
+	require.NoError(t, db.Table("users").Count(&count).Error)
+	assert.Zero(t, count, "nothing was written")
+}
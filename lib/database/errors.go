@@ -0,0 +1,59 @@
+package database
+
+import (
+	"errors"
+	"users-books-api-testing/config"
+
+	"gorm.io/gorm"
+)
+
+// The repositories report failures callers act on with these errors, or
+// errors that match them with errors.Is, never with driver or GORM errors.
+var (
+	ErrNotFound           = errors.New("record not found")
+	ErrConflict           = errors.New("record already exists")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrStaleVersion fails an update based on a version of the record that
+	// has since been superseded.
+	ErrStaleVersion = errors.New("the record was changed since it was read")
+	// ErrUnknownAuthor fails a book write naming an author that doesn't
+	// exist.
+	ErrUnknownAuthor = errors.New("no such author")
+
+	// ErrDuplicateEmail is the ErrConflict of a user whose email is taken.
+	ErrDuplicateEmail error = conflict("a user with this email already exists")
+	// ErrAuthorHasBooks is the ErrConflict of deleting an author who still
+	// has books.
+	ErrAuthorHasBooks error = conflict("the author still has books")
+	// ErrNoCopiesLeft is the ErrConflict of checking out a book every copy
+	// of which is lent out.
+	ErrNoCopiesLeft error = conflict("every copy of the book is lent out")
+	// ErrAlreadyReturned is the ErrConflict of returning a loan twice.
+	ErrAlreadyReturned error = conflict("the loan was already returned")
+	// ErrBookLentOut is the ErrConflict of deleting a book while a copy of
+	// it is lent out.
+	ErrBookLentOut error = conflict("copies of the book are still lent out")
+)
+
+// conflict is an ErrConflict with a more specific message.
+type conflict string
+
+func (e conflict) Error() string {
+	return string(e)
+}
+
+func (e conflict) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// translate turns GORM's not found and the driver's duplicate key errors
+// into ErrNotFound and ErrConflict. Other errors are returned as they are.
+func translate(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case config.IsDuplicateKey(err):
+		return ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoresReportSentinels(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		user := models.Users{Name: "a", Email: "a@example.com", Password: "a"}
+		assert.NoError(t, store.Users.CreateUser(ctx, &user), name)
+		store.Users.DeleteUserById(ctx, int(user.ID))
+
+		err := store.Users.CreateUser(ctx, &models.Users{Name: "b", Email: "A@example.com", Password: "b"})
+		assert.True(t, errors.Is(err, ErrDuplicateEmail), name)
+		assert.True(t, errors.Is(err, ErrConflict), name)
+
+		_, err = store.Users.GetUserById(ctx, int(user.ID))
+		assert.True(t, errors.Is(err, ErrNotFound), name)
+		assert.True(t, errors.Is(store.Users.UpdateUserById(ctx, 999, &models.Users{Name: "c"}), ErrNotFound), name)
+		_, err = store.Users.RefreshUserToken(ctx, 999)
+		assert.True(t, errors.Is(err, ErrNotFound), name)
+		_, err = store.Users.LoginUser(ctx, &models.Users{Email: "a@example.com", Password: "a"})
+		assert.True(t, errors.Is(err, ErrInvalidCredentials), name, "deleted users can't log in")
+
+		_, err = store.Books.GetBookById(ctx, 999)
+		assert.True(t, errors.Is(err, ErrNotFound), name)
+		assert.True(t, errors.Is(store.Books.UpdateBookById(ctx, 999, &models.Books{Title: "c"}), ErrNotFound), name)
+		assert.True(t, errors.Is(store.Books.RestoreBookById(ctx, 999), ErrNotFound), name)
+	}
+}
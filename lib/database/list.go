@@ -0,0 +1,336 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ListOptions selects one page of a listing. Pages are addressed either by
+// Offset or, for stable iteration over a changing table, by the Cursor
+// handed out with the previous page; Cursor wins when both are set.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Cursor string
+	// Sort is a whitelisted column name, prefixed with "-" to sort
+	// descending. Ties are always broken by id.
+	Sort string
+}
+
+// Page describes the result of a listing beyond the rows themselves.
+type Page struct {
+	Total int64
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+type UserFilter struct {
+	// Name matches users whose name contains it.
+	Name string
+	// Email matches the user with this email, in any case.
+	Email string
+	Role  string
+	// IncludeDeleted lists soft-deleted users too.
+	IncludeDeleted bool
+}
+
+type BookFilter struct {
+	// Author matches books whose byline is it, in any case.
+	Author string
+	// AuthorID matches the books linked to the author with this id.
+	AuthorID uint
+	// Title matches books whose title contains it.
+	Title    string
+	YearFrom int
+	YearTo   int
+	// IncludeDeleted lists soft-deleted books too.
+	IncludeDeleted bool
+}
+
+type AuthorFilter struct {
+	// Name matches authors whose name contains it.
+	Name string
+}
+
+// The statuses a loan can be listed by.
+const (
+	LoanActive   = "active"
+	LoanReturned = "returned"
+	// LoanOverdue loans are active ones past their due date.
+	LoanOverdue = "overdue"
+)
+
+type LoanFilter struct {
+	UserID uint
+	BookID uint
+	// Status is LoanActive, LoanReturned or LoanOverdue; empty matches
+	// every loan.
+	Status string
+}
+
+type columnKind int
+
+const (
+	kindInt columnKind = iota
+	kindString
+	kindTime
+)
+
+var userSortColumns = map[string]columnKind{
+	"id":         kindInt,
+	"name":       kindString,
+	"email":      kindString,
+	"created_at": kindTime,
+}
+
+var authorSortColumns = map[string]columnKind{
+	"id":         kindInt,
+	"name":       kindString,
+	"created_at": kindTime,
+}
+
+var loanSortColumns = map[string]columnKind{
+	"id":         kindInt,
+	"due_at":     kindTime,
+	"created_at": kindTime,
+}
+
+var bookSortColumns = map[string]columnKind{
+	"id":         kindInt,
+	"title":      kindString,
+	"author":     kindString,
+	"year":       kindInt,
+	"created_at": kindTime,
+}
+
+// listQuery is a validated ListOptions.
+type listQuery struct {
+	limit    int
+	offset   int
+	column   string
+	kind     columnKind
+	desc     bool
+	after    *cursor
+	afterVal interface{}
+}
+
+type cursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func newListQuery(opts ListOptions, columns map[string]columnKind) (listQuery, error) {
+	q := listQuery{limit: opts.Limit, offset: opts.Offset, column: "id"}
+	if q.limit <= 0 {
+		q.limit = DefaultLimit
+	}
+	if q.limit > MaxLimit {
+		q.limit = MaxLimit
+	}
+	if q.offset < 0 {
+		return q, fmt.Errorf("%w: offset must not be negative", ErrInvalidListOptions)
+	}
+
+	if opts.Sort != "" {
+		q.column = strings.TrimPrefix(opts.Sort, "-")
+		q.desc = strings.HasPrefix(opts.Sort, "-")
+	}
+	kind, ok := columns[q.column]
+	if !ok {
+		return q, fmt.Errorf("%w: cannot sort by %q", ErrInvalidListOptions, q.column)
+	}
+	q.kind = kind
+
+	if opts.Cursor != "" {
+		c, value, err := decodeCursor(opts.Cursor, kind)
+		if err != nil {
+			return q, err
+		}
+		q.after, q.afterVal, q.offset = &c, value, 0
+	}
+	return q, nil
+}
+
+// apply adds ordering, the cursor condition and the page window to db. It
+// fetches one row more than the limit so the caller can tell whether there
+// is a next page.
+func (q listQuery) apply(db *gorm.DB) *gorm.DB {
+	dir, cmp := "ASC", ">"
+	if q.desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if q.after != nil {
+		if q.column == "id" {
+			db = db.Where("id "+cmp+" ?", q.after.ID)
+		} else {
+			db = db.Where(
+				fmt.Sprintf("%s %s ? OR (%s = ? AND id %s ?)", q.column, cmp, q.column, cmp),
+				q.afterVal, q.afterVal, q.after.ID,
+			)
+		}
+	}
+	if q.column != "id" {
+		db = db.Order(q.column + " " + dir)
+	}
+	return db.Order("id " + dir).Offset(q.offset).Limit(q.limit + 1)
+}
+
+// window applies q to rows that are already filtered, for the in-memory
+// repositories. value returns the sort value of row i.
+func (q listQuery) window(n int, id func(i int) uint, value func(i int, column string) interface{}, swap func(i, j int)) (start, end int) {
+	less := func(i, j int) bool {
+		c := compareValues(value(i, q.column), value(j, q.column))
+		if c == 0 {
+			c = compareValues(id(i), id(j))
+		}
+		if q.desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Sort(funcSorter{n: n, less: less, swap: swap})
+
+	start = q.offset
+	if q.after != nil {
+		start = sort.Search(n, func(i int) bool {
+			c := compareValues(value(i, q.column), q.afterVal)
+			if c == 0 {
+				c = compareValues(id(i), q.after.ID)
+			}
+			if q.desc {
+				return c < 0
+			}
+			return c > 0
+		})
+	}
+	if start > n {
+		start = n
+	}
+	end = start + q.limit + 1
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+// page trims the extra row fetched by apply or window and builds the Page
+// for the n rows that were returned.
+func (q listQuery) page(total int64, n int, id func(i int) uint, value func(i int, column string) interface{}) (int, Page) {
+	page := Page{Total: total}
+	if n > q.limit {
+		n = q.limit
+		page.NextCursor = encodeCursor(cursor{Value: formatValue(value(n-1, q.column)), ID: id(n - 1)})
+	}
+	return n, page
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, kind columnKind) (cursor, interface{}, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return c, nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	var value interface{}
+	switch kind {
+	case kindInt:
+		value, err = strconv.Atoi(c.Value)
+	case kindTime:
+		var t time.Time
+		// rows carry local timestamps; SQLite compares them as text, so
+		// the cursor value has to be in the same zone
+		t, err = time.Parse(time.RFC3339Nano, c.Value)
+		value = t.Local()
+	default:
+		value = c.Value
+	}
+	if err != nil {
+		return c, nil, fmt.Errorf("%w: cursor does not match sort", ErrInvalidListOptions)
+	}
+	return c, value, nil
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		return compareInts(int64(a), int64(b.(int)))
+	case uint:
+		return compareInts(int64(a), int64(b.(uint)))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		b := b.(time.Time)
+		if a.Before(b) {
+			return -1
+		}
+		if a.After(b) {
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// likeContains builds the argument for a "LIKE ? ESCAPE '!'" condition that
+// matches values containing s. '!' is used because backslash escaping
+// differs between MySQL and SQLite.
+func likeContains(s string) string {
+	r := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return "%" + r.Replace(s) + "%"
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type funcSorter struct {
+	n    int
+	less func(i, j int) bool
+	swap func(i, j int)
+}
+
+func (s funcSorter) Len() int           { return s.n }
+func (s funcSorter) Less(i, j int) bool { return s.less(i, j) }
+func (s funcSorter) Swap(i, j int)      { s.swap(i, j) }
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"users-books-api-testing/models"
+
+	"gorm.io/gorm"
+)
+
+type gormLoanRepository struct {
+	db *gorm.DB
+}
+
+func NewGormLoanRepository(db *gorm.DB) LoanRepository {
+	return &gormLoanRepository{db: db}
+}
+
+func (r *gormLoanRepository) CheckOutBook(ctx context.Context, loan *models.Loans) error {
+	// in the zone of the other timestamps, which SQLite compares as text;
+	// see decodeCursor
+	loan.DueAt = loan.DueAt.Local()
+	loan.ReturnedAt = nil
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Writing the book's row before reading anything makes checkouts of
+		// the same book wait for each other: MySQL locks the row and SQLite
+		// the database until commit. The loans counted below then include
+		// those of every checkout that got there first.
+		if err := tx.Table("books").Where("id = ?", loan.BookID).Update("copies", gorm.Expr("copies")).Error; err != nil {
+			return err
+		}
+		var book models.Books
+		if err := tx.Table("books").Select("id", "copies").First(&book, loan.BookID).Error; err != nil {
+			return translate(err)
+		}
+		var users int64
+		if err := tx.Table("users").Where("id = ? AND deleted_at IS NULL", loan.UserID).Count(&users).Error; err != nil {
+			return err
+		}
+		if users == 0 {
+			return ErrNotFound
+		}
+
+		var out int64
+		if err := tx.Table("loans").Where("book_id = ? AND returned_at IS NULL", loan.BookID).Count(&out).Error; err != nil {
+			return err
+		}
+		if out >= int64(book.Copies) {
+			return ErrNoCopiesLeft
+		}
+		return tx.Table("loans").Create(loan).Error
+	})
+}
+
+func (r *gormLoanRepository) GetLoans(ctx context.Context, filter LoanFilter, opts ListOptions) ([]models.Loans, Page, error) {
+	q, err := newListQuery(opts, loanSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	if err := checkLoanStatus(filter.Status); err != nil {
+		return nil, Page{}, err
+	}
+
+	var total int64
+	if err := r.filtered(ctx, filter).Count(&total).Error; err != nil {
+		return nil, Page{}, err
+	}
+
+	var loans []models.Loans
+	if err := q.apply(r.filtered(ctx, filter)).Find(&loans).Error; err != nil {
+		return nil, Page{}, err
+	}
+	n, page := q.page(total, len(loans), func(i int) uint { return loans[i].ID }, func(i int, column string) interface{} {
+		return loanSortValue(loans[i], column)
+	})
+	return loans[:n], page, nil
+}
+
+func (r *gormLoanRepository) filtered(ctx context.Context, filter LoanFilter) *gorm.DB {
+	db := r.db.WithContext(ctx).Model(&models.Loans{})
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.BookID != 0 {
+		db = db.Where("book_id = ?", filter.BookID)
+	}
+	switch filter.Status {
+	case LoanActive:
+		db = db.Where("returned_at IS NULL")
+	case LoanReturned:
+		db = db.Where("returned_at IS NOT NULL")
+	case LoanOverdue:
+		db = db.Where("returned_at IS NULL AND due_at < ?", time.Now())
+	}
+	return db
+}
+
+func (r *gormLoanRepository) GetLoanById(ctx context.Context, id int) (models.Loans, error) {
+	var loan models.Loans
+	if err := r.db.WithContext(ctx).Table("loans").First(&loan, id).Error; err != nil {
+		return models.Loans{}, translate(err)
+	}
+	return loan, nil
+}
+
+func (r *gormLoanRepository) ReturnLoanById(ctx context.Context, id int) (models.Loans, error) {
+	var loan models.Loans
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("loans").First(&loan, id).Error; err != nil {
+			return translate(err)
+		}
+		now := time.Now()
+		// the condition on returned_at keeps two returns from both going
+		// through
+		result := tx.Table("loans").Where("id = ? AND returned_at IS NULL", id).
+			Updates(map[string]interface{}{"returned_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyReturned
+		}
+		loan.ReturnedAt, loan.UpdatedAt = &now, now
+		return nil
+	})
+	if err != nil {
+		return models.Loans{}, err
+	}
+	return loan, nil
+}
+
+// checkLoanStatus fails with ErrInvalidListOptions for statuses LoanFilter
+// doesn't know.
+func checkLoanStatus(status string) error {
+	switch status {
+	case "", LoanActive, LoanReturned, LoanOverdue:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown loan status %q", ErrInvalidListOptions, status)
+}
+
+func matchLoan(loan models.Loans, filter LoanFilter, now time.Time) bool {
+	if filter.UserID != 0 && loan.UserID != filter.UserID {
+		return false
+	}
+	if filter.BookID != 0 && loan.BookID != filter.BookID {
+		return false
+	}
+	switch filter.Status {
+	case LoanActive:
+		return loan.ReturnedAt == nil
+	case LoanReturned:
+		return loan.ReturnedAt != nil
+	case LoanOverdue:
+		return loan.Overdue(now)
+	}
+	return true
+}
+
+func loanSortValue(loan models.Loans, column string) interface{} {
+	switch column {
+	case "due_at":
+		return loan.DueAt
+	case "created_at":
+		return loan.CreatedAt
+	default:
+		return int(loan.ID)
+	}
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoans(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		reader := models.Users{Name: "reader", Email: "reader@example.com", Password: "secret"}
+		require.NoError(t, store.Users.CreateUser(ctx, &reader), name)
+		book := models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965}
+		require.NoError(t, store.Books.AddBook(ctx, &book), name)
+		assert.Equal(t, 1, book.Copies, name)
+		due := time.Now().Add(24 * time.Hour)
+
+		// one copy can only be out once
+		loan := models.Loans{BookID: book.ID, UserID: reader.ID, DueAt: due}
+		require.NoError(t, store.Loans.CheckOutBook(ctx, &loan), name)
+		assert.NotZero(t, loan.ID, name)
+		assert.ErrorIs(t, store.Loans.CheckOutBook(ctx, &models.Loans{BookID: book.ID, UserID: reader.ID, DueAt: due}), ErrNoCopiesLeft, name)
+		assert.ErrorIs(t, store.Loans.CheckOutBook(ctx, &models.Loans{BookID: 999, UserID: reader.ID, DueAt: due}), ErrNotFound, name)
+		assert.ErrorIs(t, store.Loans.CheckOutBook(ctx, &models.Loans{BookID: book.ID, UserID: 999, DueAt: due}), ErrNotFound, name)
+
+		// until it is returned, once
+		returned, err := store.Loans.ReturnLoanById(ctx, int(loan.ID))
+		require.NoError(t, err, name)
+		assert.NotNil(t, returned.ReturnedAt, name)
+		_, err = store.Loans.ReturnLoanById(ctx, int(loan.ID))
+		assert.ErrorIs(t, err, ErrAlreadyReturned, name)
+		_, err = store.Loans.ReturnLoanById(ctx, 999)
+		assert.ErrorIs(t, err, ErrNotFound, name)
+
+		// more copies, more loans
+		book.Copies = 2
+		require.NoError(t, store.Books.UpdateBookById(ctx, int(book.ID), &book), name)
+		late := models.Loans{BookID: book.ID, UserID: reader.ID, DueAt: time.Now().Add(-time.Hour)}
+		require.NoError(t, store.Loans.CheckOutBook(ctx, &late), name)
+		onTime := models.Loans{BookID: book.ID, UserID: reader.ID, DueAt: due}
+		require.NoError(t, store.Loans.CheckOutBook(ctx, &onTime), name)
+		assert.ErrorIs(t, store.Loans.CheckOutBook(ctx, &models.Loans{BookID: book.ID, UserID: reader.ID, DueAt: due}), ErrNoCopiesLeft, name)
+
+		ids := func(filter LoanFilter) []uint {
+			loans, page, err := store.Loans.GetLoans(ctx, filter, ListOptions{Sort: "due_at"})
+			require.NoError(t, err, name)
+			assert.Equal(t, int64(len(loans)), page.Total, name)
+			out := []uint{}
+			for _, loan := range loans {
+				out = append(out, loan.ID)
+			}
+			return out
+		}
+		assert.Equal(t, []uint{late.ID, loan.ID, onTime.ID}, ids(LoanFilter{UserID: reader.ID}), name)
+		assert.Equal(t, []uint{late.ID, onTime.ID}, ids(LoanFilter{BookID: book.ID, Status: LoanActive}), name)
+		assert.Equal(t, []uint{loan.ID}, ids(LoanFilter{Status: LoanReturned}), name)
+		assert.Equal(t, []uint{late.ID}, ids(LoanFilter{Status: LoanOverdue}), name)
+		assert.Equal(t, []uint{}, ids(LoanFilter{UserID: 999}), name)
+		_, _, err = store.Loans.GetLoans(ctx, LoanFilter{Status: "lost"}, ListOptions{})
+		assert.ErrorIs(t, err, ErrInvalidListOptions, name)
+	}
+}
+
+func TestConcurrentCheckoutsOfTheLastCopy(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		reader := models.Users{Name: "reader", Email: "reader@example.com", Password: "secret"}
+		require.NoError(t, store.Users.CreateUser(ctx, &reader), name)
+		book := models.Books{Title: "Hyperion", Author: "Dan Simmons", Year: 1989, Copies: 2}
+		require.NoError(t, store.Books.AddBook(ctx, &book), name)
+
+		const checkouts = 8
+		errs := make(chan error, checkouts)
+		var wg sync.WaitGroup
+		for i := 0; i < checkouts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.Loans.CheckOutBook(ctx, &models.Loans{BookID: book.ID, UserID: reader.ID, DueAt: time.Now().Add(time.Hour)})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		lent := 0
+		for err := range errs {
+			if err == nil {
+				lent++
+				continue
+			}
+			assert.ErrorIs(t, err, ErrNoCopiesLeft, name)
+		}
+		assert.Equal(t, 2, lent, name)
+		_, page, err := store.Loans.GetLoans(ctx, LoanFilter{BookID: book.ID, Status: LoanActive}, ListOptions{})
+		require.NoError(t, err, name)
+		assert.Equal(t, int64(2), page.Total, name)
+	}
+}
+
+func TestLoansPageByDueDateOutsideUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+7", 7*60*60)
+	t.Cleanup(func() { time.Local = local })
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		reader := models.Users{Name: "reader", Email: "reader@example.com", Password: "secret"}
+		require.NoError(t, store.Users.CreateUser(ctx, &reader), name)
+		book := models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965, Copies: 4}
+		require.NoError(t, store.Books.AddBook(ctx, &book), name)
+
+		// due dates given in UTC, an hour apart, two of them past
+		now := time.Now().UTC().Truncate(time.Second)
+		var want []uint
+		for _, due := range []time.Duration{-2 * time.Hour, -time.Hour, time.Hour, 2 * time.Hour} {
+			loan := models.Loans{BookID: book.ID, UserID: reader.ID, DueAt: now.Add(due)}
+			require.NoError(t, store.Loans.CheckOutBook(ctx, &loan), name)
+			want = append(want, loan.ID)
+		}
+
+		pages := func(filter LoanFilter) []uint {
+			opts := ListOptions{Sort: "due_at", Limit: 1}
+			got := []uint{}
+			for {
+				loans, page, err := store.Loans.GetLoans(ctx, filter, opts)
+				require.NoError(t, err, name)
+				for _, loan := range loans {
+					got = append(got, loan.ID)
+				}
+				if page.NextCursor == "" || len(got) > len(want) {
+					return got
+				}
+				opts.Cursor = page.NextCursor
+			}
+		}
+		assert.Equal(t, want, pages(LoanFilter{}), name)
+		assert.Equal(t, want[:2], pages(LoanFilter{Status: LoanOverdue}), name)
+	}
+}
+
+func TestLoansOfDeletedBooksAndUsers(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		reader := models.Users{Name: "reader", Email: "reader@example.com", Password: "secret"}
+		require.NoError(t, store.Users.CreateUser(ctx, &reader), name)
+		dune := models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965}
+		require.NoError(t, store.Books.AddBook(ctx, &dune), name)
+		hyperion := models.Books{Title: "Hyperion", Author: "Dan Simmons", Year: 1989}
+		require.NoError(t, store.Books.AddBook(ctx, &hyperion), name)
+		due := time.Now().Add(24 * time.Hour)
+
+		// a book can't be deleted while it's out
+		returned := models.Loans{BookID: dune.ID, UserID: reader.ID, DueAt: due}
+		require.NoError(t, store.Loans.CheckOutBook(ctx, &returned), name)
+		assert.ErrorIs(t, store.Books.DeleteBookById(ctx, int(dune.ID)), ErrBookLentOut, name)
+		_, err := store.Books.GetBookById(ctx, int(dune.ID))
+		require.NoError(t, err, name)
+		_, err = store.Loans.ReturnLoanById(ctx, int(returned.ID))
+		require.NoError(t, err, name)
+		require.NoError(t, store.Books.DeleteBookById(ctx, int(dune.ID)), name)
+
+		// a user can, but isn't purged while they have a book out
+		out := models.Loans{BookID: hyperion.ID, UserID: reader.ID, DueAt: due}
+		require.NoError(t, store.Loans.CheckOutBook(ctx, &out), name)
+		require.NoError(t, store.Users.DeleteUserById(ctx, int(reader.ID)), name)
+
+		users, books, err := store.Purge(ctx, time.Now())
+		require.NoError(t, err, name)
+		assert.Zero(t, users, name)
+		assert.Equal(t, int64(1), books, name)
+		_, err = store.Loans.GetLoanById(ctx, int(returned.ID))
+		assert.ErrorIs(t, err, ErrNotFound, name, "purged with its book")
+		stillOut, err := store.Loans.GetLoanById(ctx, int(out.ID))
+		require.NoError(t, err, name)
+		assert.Nil(t, stillOut.ReturnedAt, name)
+		assert.ErrorIs(t, store.Loans.CheckOutBook(ctx, &models.Loans{BookID: hyperion.ID, UserID: reader.ID, DueAt: due}), ErrNotFound, name)
+
+		// once it's back, the user goes with their loans
+		_, err = store.Loans.ReturnLoanById(ctx, int(out.ID))
+		require.NoError(t, err, name)
+		users, _, err = store.Purge(ctx, time.Now())
+		require.NoError(t, err, name)
+		assert.Equal(t, int64(1), users, name)
+		_, err = store.Loans.GetLoanById(ctx, int(out.ID))
+		assert.ErrorIs(t, err, ErrNotFound, name)
+		_, page, err := store.Loans.GetLoans(ctx, LoanFilter{}, ListOptions{})
+		require.NoError(t, err, name)
+		assert.Zero(t, page.Total, name)
+	}
+}
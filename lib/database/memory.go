@@ -0,0 +1,1002 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"users-books-api-testing/models"
+
+	"gorm.io/gorm"
+)
+
+// The memory repositories mirror what the GORM ones do against a real
+// table: ids are assigned on insert, deletes are soft, updates check and
+// bump the version, and nothing runs once the context is done.
+
+type memoryUserRepository struct {
+	mu     sync.RWMutex
+	rows   map[uint]models.Users
+	nextID uint
+	tokens TokenRepository
+	// loans has the loans of the users, purged with them. Its lock is
+	// taken before mu, the order checkouts take them in.
+	loans *memoryLoanRepository
+}
+
+func NewMemoryUserRepository(tokens TokenRepository) UserRepository {
+	return newMemoryUserRepository(tokens)
+}
+
+func newMemoryUserRepository(tokens TokenRepository) *memoryUserRepository {
+	return &memoryUserRepository{rows: map[uint]models.Users{}, nextID: 1, tokens: tokens, loans: newMemoryLoanRepository(nil, nil)}
+}
+
+func (r *memoryUserRepository) CreateUser(ctx context.Context, user *models.Users) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	setDefaultRole(user)
+	normalizeEmail(user)
+	if err := setPassword(user); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+	now := time.Now()
+	if user.ID == 0 {
+		user.ID = r.nextID
+	}
+	if user.ID >= r.nextID {
+		r.nextID = user.ID + 1
+	}
+	user.CreatedAt, user.UpdatedAt = now, now
+	user.Version = 1
+	r.rows[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) GetUsers(ctx context.Context, filter UserFilter, opts ListOptions) ([]models.Users, Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Page{}, err
+	}
+	q, err := newListQuery(opts, userSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []models.Users{}
+	for _, user := range r.rows {
+		if (!user.DeletedAt.Valid || filter.IncludeDeleted) && matchUser(user, filter) {
+			users = append(users, user)
+		}
+	}
+
+	id := func(i int) uint { return users[i].ID }
+	value := func(i int, column string) interface{} { return userSortValue(users[i], column) }
+	start, end := q.window(len(users), id, value, func(i, j int) { users[i], users[j] = users[j], users[i] })
+	total := int64(len(users))
+	users = users[start:end]
+	n, page := q.page(total, len(users), id, value)
+	return users[:n], page, nil
+}
+
+func (r *memoryUserRepository) GetUserById(ctx context.Context, id int) (models.Users, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Users{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.find(id)
+	if !ok {
+		return models.Users{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) UpdateUserById(ctx context.Context, id int, user *models.Users) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	normalizeEmail(user)
+	if err := setPassword(user); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.find(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != user.Version {
+		return ErrStaleVersion
+	}
+	if r.emailTaken(user.Email, stored.ID) {
+		return ErrDuplicateEmail
+	}
+	roleChanged := stored.Role != user.Role
+	stored.Name, stored.Email, stored.Role = user.Name, user.Email, user.Role
+	if user.PasswordHash != "" {
+		stored.PasswordHash = user.PasswordHash
+	}
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	user.Version = stored.Version
+	r.rows[stored.ID] = stored
+	if !roleChanged {
+		return nil
+	}
+	return endSessions(ctx, stored, r.tokens)
+}
+
+func (r *memoryUserRepository) DeleteUserById(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.find(id)
+	if !ok {
+		return ErrNotFound
+	}
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.rows[user.ID] = user
+	return endSessions(ctx, user, r.tokens)
+}
+
+func (r *memoryUserRepository) RestoreUserById(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.rows[uint(id)]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.DeletedAt.Valid {
+		user.DeletedAt = gorm.DeletedAt{}
+		user.UpdatedAt = time.Now()
+		user.Version++
+		r.rows[user.ID] = user
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.loans.mu.Lock()
+	defer r.loans.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, user := range r.rows {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(deletedBefore) && !r.loans.borrowing(id) {
+			delete(r.rows, id)
+			r.loans.drop(func(loan models.Loans) bool { return loan.UserID == id })
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *memoryUserRepository) LoginUser(ctx context.Context, user *models.Users) (models.Users, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Users{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	email := NormalizeEmail(user.Email)
+	var found models.Users
+	for _, row := range r.rows {
+		if !row.DeletedAt.Valid && row.Email == email {
+			found = row
+			break
+		}
+	}
+	if found.ID == 0 {
+		return models.Users{}, rejectLogin(user.Password)
+	}
+
+	stored := found.PasswordHash
+	if err := authenticate(&found, user.Password); err != nil {
+		return models.Users{}, err
+	}
+	if err := issueToken(ctx, &found, r.tokens); err != nil {
+		return models.Users{}, err
+	}
+	if found.PasswordHash != stored {
+		found.Version++
+		found.UpdatedAt = time.Now()
+	}
+	r.rows[found.ID] = found
+	return found, nil
+}
+
+func (r *memoryUserRepository) RefreshUserToken(ctx context.Context, id int) (models.Users, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Users{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.find(id)
+	if !ok {
+		return models.Users{}, ErrNotFound
+	}
+	if err := issueToken(ctx, &user, r.tokens); err != nil {
+		return models.Users{}, err
+	}
+	r.rows[user.ID] = user
+	return user, nil
+}
+
+// find must be called with r.mu held.
+func (r *memoryUserRepository) find(id int) (models.Users, bool) {
+	user, ok := r.rows[uint(id)]
+	if !ok || user.DeletedAt.Valid {
+		return models.Users{}, false
+	}
+	return user, true
+}
+
+// emailTaken reports whether a user other than except has email. Like the
+// unique index, it counts soft-deleted users. It must be called with r.mu
+// held.
+func (r *memoryUserRepository) emailTaken(email string, except uint) bool {
+	for _, row := range r.rows {
+		if row.ID != except && row.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryBookRepository also keeps which authors each book is by, and shares
+// them with its memoryAuthorRepository. Code that needs both locks takes the
+// books' first.
+type memoryBookRepository struct {
+	mu     sync.RWMutex
+	rows   map[uint]models.Books
+	nextID uint
+	// links has the ids of the authors of each book, in byline order.
+	links   map[uint][]uint
+	authors *memoryAuthorRepository
+	// loans has the loans of the books, which keep them from being deleted
+	// and are purged with them. Its lock is taken before mu, the order
+	// checkouts take them in.
+	loans *memoryLoanRepository
+}
+
+func NewMemoryBookRepository() BookRepository {
+	return newMemoryBookRepository()
+}
+
+func newMemoryBookRepository() *memoryBookRepository {
+	r := &memoryBookRepository{rows: map[uint]models.Books{}, nextID: 1, links: map[uint][]uint{}, loans: newMemoryLoanRepository(nil, nil)}
+	r.authors = &memoryAuthorRepository{rows: map[uint]models.Authors{}, nextID: 1, books: r}
+	return r
+}
+
+func (r *memoryBookRepository) AddBook(ctx context.Context, book *models.Books) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	authorIDs, err := r.bookAuthors(book)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if book.ID == 0 {
+		book.ID = r.nextID
+	}
+	if book.ID >= r.nextID {
+		r.nextID = book.ID + 1
+	}
+	book.CreatedAt, book.UpdatedAt = now, now
+	book.Version = 1
+	if book.Copies <= 0 {
+		book.Copies = 1
+	}
+	row := *book
+	row.AuthorIDs = nil
+	r.rows[book.ID] = row
+	r.links[book.ID] = authorIDs
+	return nil
+}
+
+func (r *memoryBookRepository) GetBooks(ctx context.Context, filter BookFilter, opts ListOptions) ([]models.Books, Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Page{}, err
+	}
+	q, err := newListQuery(opts, bookSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	books := []models.Books{}
+	for _, book := range r.rows {
+		if (!book.DeletedAt.Valid || filter.IncludeDeleted) && matchBook(book, filter) &&
+			(filter.AuthorID == 0 || containsID(r.links[book.ID], filter.AuthorID)) {
+			books = append(books, book)
+		}
+	}
+
+	id := func(i int) uint { return books[i].ID }
+	value := func(i int, column string) interface{} { return bookSortValue(books[i], column) }
+	start, end := q.window(len(books), id, value, func(i, j int) { books[i], books[j] = books[j], books[i] })
+	total := int64(len(books))
+	books = books[start:end]
+	n, page := q.page(total, len(books), id, value)
+	return books[:n], page, nil
+}
+
+func (r *memoryBookRepository) GetBookById(ctx context.Context, id int) (models.Books, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Books{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	book, ok := r.find(id)
+	if !ok {
+		return models.Books{}, ErrNotFound
+	}
+	return book, nil
+}
+
+func (r *memoryBookRepository) GetBooksByIds(ctx context.Context, ids []uint) ([]models.Books, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	books := []models.Books{}
+	for _, id := range ids {
+		if book, ok := r.find(int(id)); ok {
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+func (r *memoryBookRepository) GetBooksByUserId(ctx context.Context, userId int) ([]models.Books, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	books := []models.Books{}
+	for id := uint(1); id < r.nextID; id++ {
+		if book, ok := r.rows[id]; ok && !book.DeletedAt.Valid && book.UserID == uint(userId) {
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+func (r *memoryBookRepository) UpdateBookById(ctx context.Context, id int, book *models.Books) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.find(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != book.Version {
+		return ErrStaleVersion
+	}
+	if book.AuthorIDs != nil || book.Author != stored.Author {
+		authorIDs, err := r.bookAuthors(book)
+		if err != nil {
+			return err
+		}
+		r.links[stored.ID] = authorIDs
+	}
+	stored.Title, stored.Author, stored.Year, stored.Copies = book.Title, book.Author, book.Year, book.Copies
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	book.Version = stored.Version
+	r.rows[stored.ID] = stored
+	return nil
+}
+
+func (r *memoryBookRepository) DeleteBookById(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.loans.mu.Lock()
+	defer r.loans.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if book, ok := r.find(id); ok {
+		if r.loans.lentOut(book.ID) {
+			return ErrBookLentOut
+		}
+		book.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		r.rows[book.ID] = book
+	}
+	return nil
+}
+
+func (r *memoryBookRepository) RestoreBookById(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	book, ok := r.rows[uint(id)]
+	if !ok {
+		return ErrNotFound
+	}
+	if book.DeletedAt.Valid {
+		book.DeletedAt = gorm.DeletedAt{}
+		book.UpdatedAt = time.Now()
+		book.Version++
+		r.rows[book.ID] = book
+	}
+	return nil
+}
+
+func (r *memoryBookRepository) PurgeBooks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.loans.mu.Lock()
+	defer r.loans.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, book := range r.rows {
+		if book.DeletedAt.Valid && book.DeletedAt.Time.Before(deletedBefore) {
+			delete(r.rows, id)
+			delete(r.links, id)
+			r.loans.drop(func(loan models.Loans) bool { return loan.BookID == id })
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// find must be called with r.mu held.
+func (r *memoryBookRepository) find(id int) (models.Books, bool) {
+	book, ok := r.rows[uint(id)]
+	if !ok || book.DeletedAt.Valid {
+		return models.Books{}, false
+	}
+	return book, true
+}
+
+// bookAuthors returns the ids of the authors book is to be linked to, as
+// described at BookRepository, and sets its Author to match. It must be
+// called with r.mu held.
+func (r *memoryBookRepository) bookAuthors(book *models.Books) ([]uint, error) {
+	a := r.authors
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if book.AuthorIDs == nil {
+		name := strings.TrimSpace(book.Author)
+		if name == "" {
+			return nil, nil
+		}
+		author, ok := a.named(name)
+		if !ok {
+			author = models.Authors{Name: name}
+			a.insert(&author)
+		}
+		book.Author = name
+		return []uint{author.ID}, nil
+	}
+
+	var found []models.Authors
+	for _, id := range book.AuthorIDs {
+		if author, ok := a.find(int(id)); ok {
+			found = append(found, author)
+		}
+	}
+	authors, err := orderAuthors(book.AuthorIDs, found)
+	if err != nil {
+		return nil, err
+	}
+	book.Author = byline(authors)
+	ids := make([]uint, len(authors))
+	for i, author := range authors {
+		ids[i] = author.ID
+	}
+	return ids, nil
+}
+
+type memoryAuthorRepository struct {
+	mu     sync.RWMutex
+	rows   map[uint]models.Authors
+	nextID uint
+	books  *memoryBookRepository
+}
+
+func (r *memoryAuthorRepository) CreateAuthor(ctx context.Context, author *models.Authors) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	author.Name = strings.TrimSpace(author.Name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.insert(author)
+	return nil
+}
+
+func (r *memoryAuthorRepository) GetAuthors(ctx context.Context, filter AuthorFilter, opts ListOptions) ([]models.Authors, Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Page{}, err
+	}
+	q, err := newListQuery(opts, authorSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	authors := []models.Authors{}
+	for _, author := range r.rows {
+		if !author.DeletedAt.Valid && matchAuthor(author, filter) {
+			authors = append(authors, author)
+		}
+	}
+
+	id := func(i int) uint { return authors[i].ID }
+	value := func(i int, column string) interface{} { return authorSortValue(authors[i], column) }
+	start, end := q.window(len(authors), id, value, func(i, j int) { authors[i], authors[j] = authors[j], authors[i] })
+	total := int64(len(authors))
+	authors = authors[start:end]
+	n, page := q.page(total, len(authors), id, value)
+	return authors[:n], page, nil
+}
+
+func (r *memoryAuthorRepository) GetAuthorById(ctx context.Context, id int) (models.Authors, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Authors{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	author, ok := r.find(id)
+	if !ok {
+		return models.Authors{}, ErrNotFound
+	}
+	return author, nil
+}
+
+func (r *memoryAuthorRepository) UpdateAuthorById(ctx context.Context, id int, author *models.Authors) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	author.Name = strings.TrimSpace(author.Name)
+
+	r.books.mu.Lock()
+	defer r.books.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.find(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != author.Version {
+		return ErrStaleVersion
+	}
+	stored.Name = author.Name
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	author.Version = stored.Version
+	r.rows[stored.ID] = stored
+
+	for bookID, authorIDs := range r.books.links {
+		if !containsID(authorIDs, stored.ID) {
+			continue
+		}
+		authors := make([]models.Authors, len(authorIDs))
+		for i, authorID := range authorIDs {
+			authors[i] = r.rows[authorID]
+		}
+		book := r.books.rows[bookID]
+		book.Author = byline(authors)
+		book.UpdatedAt = time.Now()
+		book.Version++
+		r.books.rows[bookID] = book
+	}
+	return nil
+}
+
+func (r *memoryAuthorRepository) DeleteAuthorById(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.books.mu.RLock()
+	defer r.books.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for bookID, authorIDs := range r.books.links {
+		if _, live := r.books.find(int(bookID)); live && containsID(authorIDs, uint(id)) {
+			return ErrAuthorHasBooks
+		}
+	}
+	if author, ok := r.find(id); ok {
+		author.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		r.rows[author.ID] = author
+	}
+	return nil
+}
+
+func (r *memoryAuthorRepository) GetAuthorsOfBooks(ctx context.Context, bookIDs []uint) (map[uint][]models.Authors, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.books.mu.RLock()
+	defer r.books.mu.RUnlock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	found := map[uint][]models.Authors{}
+	for _, bookID := range bookIDs {
+		for _, authorID := range r.books.links[bookID] {
+			if author, ok := r.find(int(authorID)); ok {
+				found[bookID] = append(found[bookID], author)
+			}
+		}
+	}
+	return found, nil
+}
+
+// insert must be called with r.mu held.
+func (r *memoryAuthorRepository) insert(author *models.Authors) {
+	now := time.Now()
+	author.ID = r.nextID
+	r.nextID++
+	author.CreatedAt, author.UpdatedAt = now, now
+	author.Version = 1
+	r.rows[author.ID] = *author
+}
+
+// find must be called with r.mu held.
+func (r *memoryAuthorRepository) find(id int) (models.Authors, bool) {
+	author, ok := r.rows[uint(id)]
+	if !ok || author.DeletedAt.Valid {
+		return models.Authors{}, false
+	}
+	return author, true
+}
+
+// named returns the first author with name. It must be called with r.mu
+// held.
+func (r *memoryAuthorRepository) named(name string) (models.Authors, bool) {
+	for id := uint(1); id < r.nextID; id++ {
+		if author, ok := r.find(int(id)); ok && author.Name == name {
+			return author, true
+		}
+	}
+	return models.Authors{}, false
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryLoanRepository looks books and users up through their repositories.
+// Checkouts hold its lock throughout, so they can't race each other.
+type memoryLoanRepository struct {
+	mu     sync.RWMutex
+	rows   map[uint]models.Loans
+	nextID uint
+	books  BookRepository
+	users  UserRepository
+}
+
+func NewMemoryLoanRepository(books BookRepository, users UserRepository) LoanRepository {
+	return newMemoryLoanRepository(books, users)
+}
+
+func newMemoryLoanRepository(books BookRepository, users UserRepository) *memoryLoanRepository {
+	return &memoryLoanRepository{rows: map[uint]models.Loans{}, nextID: 1, books: books, users: users}
+}
+
+func (r *memoryLoanRepository) CheckOutBook(ctx context.Context, loan *models.Loans) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	book, err := r.books.GetBookById(ctx, int(loan.BookID))
+	if err != nil {
+		return err
+	}
+	if _, err := r.users.GetUserById(ctx, int(loan.UserID)); err != nil {
+		return err
+	}
+	out := 0
+	for _, other := range r.rows {
+		if other.BookID == book.ID && other.ReturnedAt == nil {
+			out++
+		}
+	}
+	if out >= book.Copies {
+		return ErrNoCopiesLeft
+	}
+
+	now := time.Now()
+	loan.ID = r.nextID
+	r.nextID++
+	loan.CreatedAt, loan.UpdatedAt = now, now
+	loan.DueAt = loan.DueAt.Local()
+	loan.ReturnedAt = nil
+	r.rows[loan.ID] = *loan
+	return nil
+}
+
+func (r *memoryLoanRepository) GetLoans(ctx context.Context, filter LoanFilter, opts ListOptions) ([]models.Loans, Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Page{}, err
+	}
+	q, err := newListQuery(opts, loanSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	if err := checkLoanStatus(filter.Status); err != nil {
+		return nil, Page{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	loans := []models.Loans{}
+	for _, loan := range r.rows {
+		if matchLoan(loan, filter, now) {
+			loans = append(loans, loan)
+		}
+	}
+
+	id := func(i int) uint { return loans[i].ID }
+	value := func(i int, column string) interface{} { return loanSortValue(loans[i], column) }
+	start, end := q.window(len(loans), id, value, func(i, j int) { loans[i], loans[j] = loans[j], loans[i] })
+	total := int64(len(loans))
+	loans = loans[start:end]
+	n, page := q.page(total, len(loans), id, value)
+	return loans[:n], page, nil
+}
+
+func (r *memoryLoanRepository) GetLoanById(ctx context.Context, id int) (models.Loans, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Loans{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	loan, ok := r.rows[uint(id)]
+	if !ok {
+		return models.Loans{}, ErrNotFound
+	}
+	return loan, nil
+}
+
+func (r *memoryLoanRepository) ReturnLoanById(ctx context.Context, id int) (models.Loans, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Loans{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loan, ok := r.rows[uint(id)]
+	if !ok {
+		return models.Loans{}, ErrNotFound
+	}
+	if loan.ReturnedAt != nil {
+		return models.Loans{}, ErrAlreadyReturned
+	}
+	now := time.Now()
+	loan.ReturnedAt, loan.UpdatedAt = &now, now
+	r.rows[loan.ID] = loan
+	return loan, nil
+}
+
+// lentOut reports whether a copy of the book with id is out. It must be
+// called with r.mu held.
+func (r *memoryLoanRepository) lentOut(bookID uint) bool {
+	for _, loan := range r.rows {
+		if loan.BookID == bookID && loan.ReturnedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// borrowing reports whether the user with id has a book out. It must be
+// called with r.mu held.
+func (r *memoryLoanRepository) borrowing(userID uint) bool {
+	for _, loan := range r.rows {
+		if loan.UserID == userID && loan.ReturnedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// drop deletes the loans that match. It must be called with r.mu held.
+func (r *memoryLoanRepository) drop(match func(models.Loans) bool) {
+	for id, loan := range r.rows {
+		if match(loan) {
+			delete(r.rows, id)
+		}
+	}
+}
+
+type memoryTokenRepository struct {
+	mu      sync.Mutex
+	refresh map[string]models.RefreshTokens
+	revoked map[string]time.Time
+	nextID  uint
+}
+
+func NewMemoryTokenRepository() TokenRepository {
+	return &memoryTokenRepository{
+		refresh: map[string]models.RefreshTokens{},
+		revoked: map[string]time.Time{},
+		nextID:  1,
+	}
+}
+
+func (r *memoryTokenRepository) CreateRefreshToken(ctx context.Context, userID uint) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, _, err := r.insert(userID)
+	return token, err
+}
+
+func (r *memoryTokenRepository) RotateRefreshToken(ctx context.Context, token string) (uint, string, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.refresh[hashToken(token)]
+	if !ok || time.Now().After(current.ExpiresAt) {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if current.RevokedAt != nil {
+		r.revokeUser(current.UserID)
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	next, row, err := r.insert(current.UserID)
+	if err != nil {
+		return 0, "", err
+	}
+	now := time.Now()
+	current.RevokedAt = &now
+	current.ReplacedByID = &row.ID
+	r.refresh[current.TokenHash] = current
+	return current.UserID, next, nil
+}
+
+func (r *memoryTokenRepository) RevokeRefreshToken(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if row, ok := r.refresh[hashToken(token)]; ok && row.RevokedAt == nil {
+		now := time.Now()
+		row.RevokedAt = &now
+		r.refresh[row.TokenHash] = row
+	}
+	return nil
+}
+
+func (r *memoryTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokeUser(userID)
+	return nil
+}
+
+func (r *memoryTokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range r.revoked {
+		if exp.Before(now) {
+			delete(r.revoked, id)
+		}
+	}
+	r.revoked[jti] = expiresAt
+	return nil
+}
+
+func (r *memoryTokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.revoked[jti]
+	return ok, nil
+}
+
+// insert must be called with r.mu held.
+func (r *memoryTokenRepository) insert(userID uint) (string, models.RefreshTokens, error) {
+	token, row, err := newRefreshToken(userID)
+	if err != nil {
+		return "", row, err
+	}
+	row.ID = r.nextID
+	r.nextID++
+	row.CreatedAt, row.UpdatedAt = time.Now(), time.Now()
+	r.refresh[row.TokenHash] = row
+	return token, row, nil
+}
+
+// revokeUser must be called with r.mu held.
+func (r *memoryTokenRepository) revokeUser(userID uint) {
+	now := time.Now()
+	for hash, row := range r.refresh {
+		if row.UserID == userID && row.RevokedAt == nil {
+			row.RevokedAt = &now
+			r.refresh[hash] = row
+		}
+	}
+}
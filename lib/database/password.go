@@ -0,0 +1,35 @@
+package database
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when the email is unknown, so a failed
+// login takes the same time whether or not the account exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword reports whether password matches hash. Rows written before
+// passwords were hashed still hold the plain text, which is compared in
+// constant time; needsRehash tells the caller to upgrade it.
+func checkPassword(hash, password string) (ok, needsRehash bool) {
+	if !isBcryptHash(hash) {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1
+		return ok, ok
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, false
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
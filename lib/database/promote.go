@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+	"users-books-api-testing/models"
+)
+
+// PromoteUser makes the user with email an admin and returns them. Signing
+// up only makes members, so this is how the first admin comes about.
+// Promoting an admin changes nothing.
+func (s *Store) PromoteUser(ctx context.Context, email string) (models.Users, error) {
+	users, _, err := s.Users.GetUsers(ctx, UserFilter{Email: email}, ListOptions{Limit: 1})
+	if err != nil {
+		return models.Users{}, err
+	}
+	if len(users) == 0 {
+		return models.Users{}, ErrNotFound
+	}
+	user := users[0]
+	if user.Role == models.RoleAdmin {
+		return user, nil
+	}
+	user.Role = models.RoleAdmin
+	if err := s.Users.UpdateUserById(ctx, int(user.ID), &user); err != nil {
+		return models.Users{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromoteUser(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		user := models.Users{Name: "leto", Email: "leto@example.com", Password: "arrakis 1"}
+		require.NoError(t, store.Users.CreateUser(ctx, &user), name)
+		require.Equal(t, models.RoleMember, user.Role, name)
+
+		promoted, err := store.PromoteUser(ctx, " Leto@Example.com")
+		require.NoError(t, err, name)
+		assert.Equal(t, user.ID, promoted.ID, name)
+		assert.Equal(t, models.RoleAdmin, promoted.Role, name)
+		stored, err := store.Users.GetUserById(ctx, int(user.ID))
+		require.NoError(t, err, name)
+		assert.Equal(t, models.RoleAdmin, stored.Role, name)
+		assert.Equal(t, user.Version+1, stored.Version, name)
+
+		// the password is untouched
+		_, err = store.Users.LoginUser(ctx, &models.Users{Email: "leto@example.com", Password: "arrakis 1"})
+		assert.NoError(t, err, name)
+
+		// promoting an admin changes nothing
+		again, err := store.PromoteUser(ctx, "leto@example.com")
+		require.NoError(t, err, name)
+		assert.Equal(t, stored.Version, again.Version, name)
+
+		_, err = store.PromoteUser(ctx, "nobody@example.com")
+		assert.ErrorIs(t, err, ErrNotFound, name)
+		require.NoError(t, store.Users.DeleteUserById(ctx, int(user.ID)), name)
+		_, err = store.PromoteUser(ctx, "leto@example.com")
+		assert.ErrorIs(t, err, ErrNotFound, name, "deleted users aren't promoted")
+	}
+}
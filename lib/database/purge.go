@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"time"
+	"users-books-api-testing/lib/logging"
+)
+
+// Purge permanently removes the users and books soft-deleted before
+// deletedBefore, and their loans. Users with a book still out are kept,
+// restorable, until it is returned, so copies don't go back on the shelf
+// unseen. A purged user's books are left alone, the same as when the user
+// was deleted.
+func (s *Store) Purge(ctx context.Context, deletedBefore time.Time) (users, books int64, err error) {
+	if books, err = s.Books.PurgeBooks(ctx, deletedBefore); err != nil {
+		return 0, books, err
+	}
+	users, err = s.Users.PurgeUsers(ctx, deletedBefore)
+	return users, books, err
+}
+
+// PurgeEvery runs Purge every interval, and once right away, for the
+// records soft-deleted more than retention ago, until ctx is done.
+func (s *Store) PurgeEvery(ctx context.Context, interval, retention time.Duration) {
+	log := logging.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		users, books, err := s.Purge(ctx, time.Now().Add(-retention))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Error().Err(err).Msg("purging deleted records")
+		case users > 0 || books > 0:
+			log.Info().Int64("users", users).Int64("books", books).Msg("purged deleted records")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
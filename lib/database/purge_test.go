@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, user := range []models.Users{
+		{Name: "kept", Email: "kept@example.com", Password: "kept"},
+		{Name: "gone", Email: "gone@example.com", Password: "gone"},
+	} {
+		store.Users.CreateUser(ctx, &user)
+	}
+	for _, book := range []models.Books{{Title: "kept"}, {Title: "gone"}, {Title: "recently deleted"}} {
+		store.Books.AddBook(ctx, &book)
+	}
+	store.Users.DeleteUserById(ctx, 2)
+	store.Books.DeleteBookById(ctx, 2)
+	cutoff := time.Now()
+	store.Books.DeleteBookById(ctx, 3)
+
+	users, books, err := store.Purge(ctx, cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), users)
+	assert.Equal(t, int64(1), books, "books deleted after the cutoff are kept")
+
+	assert.NoError(t, store.Users.RestoreUserById(ctx, 1))
+	assert.NoError(t, store.Books.RestoreBookById(ctx, 3))
+	assert.Error(t, store.Users.RestoreUserById(ctx, 2), "purged users can't be restored")
+	assert.Error(t, store.Books.RestoreBookById(ctx, 2), "purged books can't be restored")
+
+	users, books, err = store.Purge(ctx, cutoff)
+	assert.NoError(t, err)
+	assert.Zero(t, users)
+	assert.Zero(t, books)
+}
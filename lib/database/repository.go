@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"time"
+	"users-books-api-testing/models"
+
+	"gorm.io/gorm"
+)
+
+// UserRepository and BookRepository fail with ErrNotFound for ids that don't
+// exist or were deleted.
+//
+// Updates take the record as it should be stored, zero values included, at
+// the Version it was read at. They fail with ErrStaleVersion if the record has
+// been written since, and otherwise set Version to the new one.
+type UserRepository interface {
+	CreateUser(ctx context.Context, user *models.Users) error
+	GetUsers(ctx context.Context, filter UserFilter, opts ListOptions) ([]models.Users, Page, error)
+	GetUserById(ctx context.Context, id int) (models.Users, error)
+	// UpdateUserById writes the name, email and role of user, and its
+	// password if one is set. Changing the role revokes the user's access
+	// and refresh tokens.
+	UpdateUserById(ctx context.Context, id int, user *models.Users) error
+	// DeleteUserById soft-deletes the user and revokes their access and
+	// refresh tokens.
+	DeleteUserById(ctx context.Context, id int) error
+	// RestoreUserById undoes a soft delete. Restoring a user that isn't
+	// deleted does nothing.
+	RestoreUserById(ctx context.Context, id int) error
+	// PurgeUsers permanently removes the users soft-deleted before
+	// deletedBefore, along with their loans, and returns how many there
+	// were. Users with a book still out are kept until it is returned.
+	PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	LoginUser(ctx context.Context, user *models.Users) (models.Users, error)
+	// RefreshUserToken issues a new access token for the user, revoking the
+	// one it supersedes.
+	RefreshUserToken(ctx context.Context, id int) (models.Users, error)
+}
+
+// BookRepository links each book to its authors. AddBook and UpdateBookById
+// link it to the authors in AuthorIDs, when that isn't nil, and set Author to
+// their names; they fail with ErrUnknownAuthor if one of them doesn't exist.
+// Otherwise a book with a new or changed Author is linked to the author with
+// that name, who is added if there is none yet, or to nobody if Author is
+// empty.
+type BookRepository interface {
+	AddBook(ctx context.Context, book *models.Books) error
+	GetBooks(ctx context.Context, filter BookFilter, opts ListOptions) ([]models.Books, Page, error)
+	GetBookById(ctx context.Context, id int) (models.Books, error)
+	// GetBooksByIds returns the books with ids that exist and aren't
+	// deleted, in no particular order.
+	GetBooksByIds(ctx context.Context, ids []uint) ([]models.Books, error)
+	GetBooksByUserId(ctx context.Context, userId int) ([]models.Books, error)
+	// UpdateBookById writes the title, author, year and copies of book;
+	// the owner stays.
+	UpdateBookById(ctx context.Context, id int, book *models.Books) error
+	// DeleteBookById fails with ErrBookLentOut while a copy of the book is
+	// lent out.
+	DeleteBookById(ctx context.Context, id int) error
+	RestoreBookById(ctx context.Context, id int) error
+	// PurgeBooks permanently removes the books soft-deleted before
+	// deletedBefore, along with their loans, and returns how many there
+	// were.
+	PurgeBooks(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+// AuthorRepository fails and updates the way UserRepository does.
+type AuthorRepository interface {
+	CreateAuthor(ctx context.Context, author *models.Authors) error
+	GetAuthors(ctx context.Context, filter AuthorFilter, opts ListOptions) ([]models.Authors, Page, error)
+	GetAuthorById(ctx context.Context, id int) (models.Authors, error)
+	// UpdateAuthorById writes the name of author and rewrites the bylines
+	// of the author's books to match, which counts as an update of them.
+	UpdateAuthorById(ctx context.Context, id int, author *models.Authors) error
+	// DeleteAuthorById fails with ErrAuthorHasBooks while a book that isn't
+	// deleted is by the author.
+	DeleteAuthorById(ctx context.Context, id int) error
+	// GetAuthorsOfBooks returns the authors of each of the books with
+	// bookIDs, in byline order. Deleted authors are left out.
+	GetAuthorsOfBooks(ctx context.Context, bookIDs []uint) (map[uint][]models.Authors, error)
+}
+
+// LoanRepository lends the copies of books to users. A book can't have more
+// loans out than it has Copies; lowering Copies below that only stops new
+// checkouts until enough copies are back.
+type LoanRepository interface {
+	// CheckOutBook lends a copy of loan.BookID to loan.UserID until
+	// loan.DueAt. It fails with ErrNotFound if either doesn't exist and with
+	// ErrNoCopiesLeft if every copy is out, even when several checkouts of
+	// the last copy race.
+	CheckOutBook(ctx context.Context, loan *models.Loans) error
+	GetLoans(ctx context.Context, filter LoanFilter, opts ListOptions) ([]models.Loans, Page, error)
+	GetLoanById(ctx context.Context, id int) (models.Loans, error)
+	// ReturnLoanById gives the copy back and returns the loan as it is now.
+	// It fails with ErrAlreadyReturned if it has been already.
+	ReturnLoanById(ctx context.Context, id int) (models.Loans, error)
+}
+
+// TokenRepository keeps the server side state of authentication: the
+// refresh tokens handed out at login and the denylist of access tokens that
+// were revoked before their exp.
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, userID uint) (string, error)
+	// RotateRefreshToken consumes token and returns its user together with
+	// the refresh token that replaces it.
+	RotateRefreshToken(ctx context.Context, token string) (uint, string, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uint) error
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// Store groups the repositories the controllers depend on.
+type Store struct {
+	Users   UserRepository
+	Books   BookRepository
+	Authors AuthorRepository
+	Loans   LoanRepository
+	Tokens  TokenRepository
+
+	// bookIndex is set by IndexBooks.
+	bookIndex *bookIndex
+}
+
+// NewGormStore returns a Store backed by db.
+func NewGormStore(db *gorm.DB) *Store {
+	tokens := NewGormTokenRepository(db)
+	return &Store{
+		Users:   NewGormUserRepository(db, tokens),
+		Books:   NewGormBookRepository(db),
+		Authors: NewGormAuthorRepository(db),
+		Loans:   NewGormLoanRepository(db),
+		Tokens:  tokens,
+	}
+}
+
+// NewMemoryStore returns a Store that keeps everything in process memory,
+// for tests and local experiments.
+func NewMemoryStore() *Store {
+	tokens := NewMemoryTokenRepository()
+	users := newMemoryUserRepository(tokens)
+	books := newMemoryBookRepository()
+	loans := newMemoryLoanRepository(books, users)
+	users.loans, books.loans = loans, loans
+	return &Store{
+		Users:   users,
+		Books:   books,
+		Authors: books.authors,
+		Loans:   loans,
+		Tokens:  tokens,
+	}
+}
@@ -0,0 +1,247 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"users-books-api-testing/lib/logging"
+	"users-books-api-testing/lib/search"
+	"users-books-api-testing/models"
+)
+
+// ErrSearchUnavailable is returned by SearchBooks on a Store without an
+// index, or whose books couldn't be loaded into it.
+var ErrSearchUnavailable = errors.New("book search is not available")
+
+// BookSearchWeights are how much a match in each field of a book counts.
+var BookSearchWeights = map[string]float64{"title": 2, "author": 1}
+
+// BookHit is a book that matched a search.
+type BookHit struct {
+	Book  models.Books
+	Score float64
+	// Highlights has the fields that matched, by name, with the matching
+	// words in <em> tags.
+	Highlights map[string]string
+}
+
+// IndexBooks puts every book into index and, from then on, keeps index up
+// to date with the books added, updated, deleted and restored through
+// s.Books, and the bylines rewritten through s.Authors. SearchBooks runs
+// against it. Writes made by other processes aren't seen, so an index in
+// memory suits a single instance.
+//
+// If the books can't be loaded, say because the migrations haven't run yet,
+// IndexBooks returns the error but still sets the index up, and the next
+// search tries loading them again. So does the next search after a write
+// that couldn't be passed on to the index.
+func (s *Store) IndexBooks(ctx context.Context, index search.Index) error {
+	s.bookIndex = &bookIndex{Index: index, books: s.Books}
+	s.Books = &indexedBookRepository{BookRepository: s.Books, index: s.bookIndex}
+	s.Authors = &indexedAuthorRepository{AuthorRepository: s.Authors, books: s.Books, index: s.bookIndex}
+	return s.bookIndex.load(ctx)
+}
+
+// bookIndex is the index SearchBooks runs against, filled with the books
+// stored before it was set up once load succeeds.
+type bookIndex struct {
+	search.Index
+	books BookRepository
+
+	mu     sync.Mutex
+	loaded bool
+}
+
+// load puts every book into the index unless that's been done already.
+func (x *bookIndex) load(ctx context.Context) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.loaded {
+		return nil
+	}
+	if err := indexBooks(ctx, x.books, BookFilter{}, x.Index); err != nil {
+		return err
+	}
+	x.loaded = true
+	return nil
+}
+
+// stale logs err, which kept a write from reaching the index, and has the
+// next search load the books again. The write itself is stored, so it
+// doesn't fail over the index.
+func (x *bookIndex) stale(ctx context.Context, err error) {
+	logging.FromContext(ctx).Error().Err(err).Msg("updating the book index; it is reloaded on the next search")
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.loaded = false
+}
+
+// indexBooks puts the books that match filter into index.
+func indexBooks(ctx context.Context, books BookRepository, filter BookFilter, index search.Index) error {
+	opts := ListOptions{Limit: MaxLimit}
+	for {
+		found, page, err := books.GetBooks(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+		for _, book := range found {
+			if err := index.Put(ctx, bookDocument(book)); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// SearchBooks returns one page of the books matching query, best first, and
+// how many there are in all. limit and offset work as in ListOptions.
+func (s *Store) SearchBooks(ctx context.Context, query string, limit, offset int) ([]BookHit, int, error) {
+	if s.bookIndex == nil {
+		return nil, 0, ErrSearchUnavailable
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("%w: offset must not be negative", ErrInvalidListOptions)
+	}
+	if err := s.bookIndex.load(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, err
+		}
+		logging.FromContext(ctx).Error().Err(err).Msg("indexing books")
+		return nil, 0, ErrSearchUnavailable
+	}
+	hits, err := s.bookIndex.Search(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	books, err := s.Books.GetBooksByIds(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[uint]models.Books, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+
+	// hits on books deleted behind the index's back don't count
+	results := make([]BookHit, 0, len(books))
+	for _, hit := range hits {
+		if book, ok := byID[hit.ID]; ok {
+			results = append(results, BookHit{Book: book, Score: hit.Score, Highlights: hit.Highlights})
+		}
+	}
+	total := len(results)
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, total, nil
+}
+
+func bookDocument(book models.Books) search.Document {
+	return search.Document{ID: book.ID, Fields: map[string]string{
+		"title":  book.Title,
+		"author": book.Author,
+	}}
+}
+
+// indexedBookRepository passes the writes it makes on to the index. The
+// index is updated on a detached context: by then the write is stored, and
+// a request giving up mustn't leave the index behind it.
+type indexedBookRepository struct {
+	BookRepository
+	index *bookIndex
+}
+
+func (r *indexedBookRepository) AddBook(ctx context.Context, book *models.Books) error {
+	if err := r.BookRepository.AddBook(ctx, book); err != nil {
+		return err
+	}
+	if err := r.index.Put(detach(ctx), bookDocument(*book)); err != nil {
+		r.index.stale(ctx, err)
+	}
+	return nil
+}
+
+func (r *indexedBookRepository) UpdateBookById(ctx context.Context, id int, book *models.Books) error {
+	if err := r.BookRepository.UpdateBookById(ctx, id, book); err != nil {
+		return err
+	}
+	r.reindex(ctx, id)
+	return nil
+}
+
+func (r *indexedBookRepository) DeleteBookById(ctx context.Context, id int) error {
+	if err := r.BookRepository.DeleteBookById(ctx, id); err != nil {
+		return err
+	}
+	if err := r.index.Remove(detach(ctx), uint(id)); err != nil {
+		r.index.stale(ctx, err)
+	}
+	return nil
+}
+
+func (r *indexedBookRepository) RestoreBookById(ctx context.Context, id int) error {
+	if err := r.BookRepository.RestoreBookById(ctx, id); err != nil {
+		return err
+	}
+	r.reindex(ctx, id)
+	return nil
+}
+
+// reindex puts the book with id, as it is stored, into the index.
+func (r *indexedBookRepository) reindex(ctx context.Context, id int) {
+	book, err := r.BookRepository.GetBookById(detach(ctx), id)
+	if err == nil {
+		err = r.index.Put(detach(ctx), bookDocument(book))
+	}
+	if err != nil {
+		r.index.stale(ctx, err)
+	}
+}
+
+// indexedAuthorRepository reindexes the books whose bylines change with the
+// name of their author.
+type indexedAuthorRepository struct {
+	AuthorRepository
+	books BookRepository
+	index *bookIndex
+}
+
+func (r *indexedAuthorRepository) UpdateAuthorById(ctx context.Context, id int, author *models.Authors) error {
+	if err := r.AuthorRepository.UpdateAuthorById(ctx, id, author); err != nil {
+		return err
+	}
+	if err := indexBooks(detach(ctx), r.books, BookFilter{AuthorID: uint(id)}, r.index); err != nil {
+		r.index.stale(ctx, err)
+	}
+	return nil
+}
+
+// detach returns a context with the values of ctx that is never done.
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"users-books-api-testing/config"
+	"users-books-api-testing/lib/migrate"
+	"users-books-api-testing/lib/search"
+	"users-books-api-testing/migrations"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchBooksFollowsWrites(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		_, _, err := store.SearchBooks(ctx, "dune", 0, 0)
+		assert.ErrorIs(t, err, ErrSearchUnavailable, name)
+
+		// books there before the index are loaded into it, a page at a time
+		for i := 0; i < MaxLimit+1; i++ {
+			require.NoError(t, store.Books.AddBook(ctx, &models.Books{Title: "filler", Author: "nobody", Year: 2000}), name)
+		}
+		dune := models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965}
+		require.NoError(t, store.Books.AddBook(ctx, &dune), name)
+		require.NoError(t, store.IndexBooks(ctx, search.NewMemoryIndex(BookSearchWeights)), name)
+
+		titles := func(query string) []string {
+			hits, _, err := store.SearchBooks(ctx, query, 0, 0)
+			require.NoError(t, err, name)
+			out := []string{}
+			for _, hit := range hits {
+				out = append(out, hit.Book.Title)
+			}
+			return out
+		}
+		assert.Equal(t, []string{"Dune"}, titles("herbert"), name)
+
+		hits, total, err := store.SearchBooks(ctx, "filler", 10, 95)
+		require.NoError(t, err, name)
+		assert.Equal(t, MaxLimit+1, total, name)
+		assert.Len(t, hits, 6, name)
+		_, _, err = store.SearchBooks(ctx, "filler", 10, -1)
+		assert.ErrorIs(t, err, ErrInvalidListOptions, name)
+
+		messiah := models.Books{Title: "Dune Messiah", Author: "Frank Herbert", Year: 1969}
+		require.NoError(t, store.Books.AddBook(ctx, &messiah), name)
+		assert.Equal(t, []string{"Dune", "Dune Messiah"}, titles("dune"), name)
+
+		dune, err = store.Books.GetBookById(ctx, int(dune.ID))
+		require.NoError(t, err, name)
+		dune.Title = "Children of Dune"
+		require.NoError(t, store.Books.UpdateBookById(ctx, int(dune.ID), &dune), name)
+		assert.Equal(t, []string{"Children of Dune"}, titles("children"), name)
+
+		require.NoError(t, store.Books.DeleteBookById(ctx, int(messiah.ID)), name)
+		assert.Equal(t, []string{"Children of Dune"}, titles("dune"), name)
+		require.NoError(t, store.Books.RestoreBookById(ctx, int(messiah.ID)), name)
+		assert.Equal(t, []string{"Dune Messiah", "Children of Dune"}, titles("dune"), name)
+
+		// renaming an author changes the bylines of their books
+		author, err := store.Authors.GetAuthorsOfBooks(ctx, []uint{dune.ID})
+		require.NoError(t, err, name)
+		frank := author[dune.ID][0]
+		frank.Name = "Franklin Herbert"
+		require.NoError(t, store.Authors.UpdateAuthorById(ctx, int(frank.ID), &frank), name)
+		assert.ElementsMatch(t, []string{"Dune Messiah", "Children of Dune"}, titles("franklin"), name)
+	}
+}
+
+// cancelAfterWrites is a book repository whose writes cancel the request
+// once they are stored, as a client hanging up would.
+type cancelAfterWrites struct {
+	BookRepository
+	cancel context.CancelFunc
+}
+
+func (r cancelAfterWrites) AddBook(ctx context.Context, book *models.Books) error {
+	defer r.cancel()
+	return r.BookRepository.AddBook(ctx, book)
+}
+
+func (r cancelAfterWrites) UpdateBookById(ctx context.Context, id int, book *models.Books) error {
+	defer r.cancel()
+	return r.BookRepository.UpdateBookById(ctx, id, book)
+}
+
+func (r cancelAfterWrites) DeleteBookById(ctx context.Context, id int) error {
+	defer r.cancel()
+	return r.BookRepository.DeleteBookById(ctx, id)
+}
+
+func TestSearchIndexFollowsCanceledWrites(t *testing.T) {
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		var cancel context.CancelFunc
+		store.Books = cancelAfterWrites{BookRepository: store.Books, cancel: func() { cancel() }}
+		require.NoError(t, store.IndexBooks(context.Background(), search.NewMemoryIndex(BookSearchWeights)), name)
+		request := func() context.Context {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			return ctx
+		}
+		titles := func(query string) []string {
+			hits, _, err := store.SearchBooks(context.Background(), query, 0, 0)
+			require.NoError(t, err, name)
+			out := []string{}
+			for _, hit := range hits {
+				out = append(out, hit.Book.Title)
+			}
+			return out
+		}
+
+		dune := models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965}
+		require.NoError(t, store.Books.AddBook(request(), &dune), name)
+		assert.Equal(t, []string{"Dune"}, titles("dune"), name)
+
+		dune, err := store.Books.GetBookById(context.Background(), int(dune.ID))
+		require.NoError(t, err, name)
+		dune.Title = "Children of Dune"
+		require.NoError(t, store.Books.UpdateBookById(request(), int(dune.ID), &dune), name)
+		assert.Equal(t, []string{"Children of Dune"}, titles("children"), name)
+
+		require.NoError(t, store.Books.DeleteBookById(request(), int(dune.ID)), name)
+		assert.Empty(t, titles("dune"), name)
+	}
+}
+
+func TestSearchBooksRetriesLoadingTheIndex(t *testing.T) {
+	ctx := context.Background()
+	db, err := config.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	store := NewGormStore(db)
+
+	// there are no tables to load the books from yet
+	assert.Error(t, store.IndexBooks(ctx, search.NewMemoryIndex(BookSearchWeights)))
+	_, _, err = store.SearchBooks(ctx, "dune", 0, 0)
+	assert.ErrorIs(t, err, ErrSearchUnavailable)
+
+	m, err := migrate.New(db, migrations.FS)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965}).Error)
+
+	hits, total, err := store.SearchBooks(ctx, "dune", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "Dune", hits[0].Book.Title)
+}
+
+func TestSearchBooksCountsLiveBooksOnly(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		// deleting through the repository underneath leaves the index behind
+		books := store.Books
+		require.NoError(t, store.IndexBooks(ctx, search.NewMemoryIndex(BookSearchWeights)), name)
+		dune := models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965}
+		require.NoError(t, store.Books.AddBook(ctx, &dune), name)
+		messiah := models.Books{Title: "Dune Messiah", Author: "Frank Herbert", Year: 1969}
+		require.NoError(t, store.Books.AddBook(ctx, &messiah), name)
+		require.NoError(t, books.DeleteBookById(ctx, int(dune.ID)), name)
+
+		hits, total, err := store.SearchBooks(ctx, "dune", 1, 0)
+		require.NoError(t, err, name)
+		assert.Equal(t, 1, total, name)
+		require.Len(t, hits, 1, name)
+		assert.Equal(t, "Dune Messiah", hits[0].Book.Title, name)
+		hits, _, err = store.SearchBooks(ctx, "dune", 1, 1)
+		require.NoError(t, err, name)
+		assert.Empty(t, hits, name)
+	}
+}
+
+// brokenIndex fails every write while broken is set.
+type brokenIndex struct {
+	search.Index
+	broken bool
+}
+
+func (x *brokenIndex) Put(ctx context.Context, doc search.Document) error {
+	if x.broken {
+		return errors.New("index is broken")
+	}
+	return x.Index.Put(ctx, doc)
+}
+
+func (x *brokenIndex) Remove(ctx context.Context, id uint) error {
+	if x.broken {
+		return errors.New("index is broken")
+	}
+	return x.Index.Remove(ctx, id)
+}
+
+func TestSearchIndexFailuresDontFailWrites(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		index := &brokenIndex{Index: search.NewMemoryIndex(BookSearchWeights)}
+		require.NoError(t, store.IndexBooks(ctx, index), name)
+
+		index.broken = true
+		dune := models.Books{Title: "Dune", Author: "Frank Herbert", Year: 1965}
+		require.NoError(t, store.Books.AddBook(ctx, &dune), name)
+		_, err := store.Books.GetBookById(ctx, int(dune.ID))
+		require.NoError(t, err, name)
+
+		// the next search loads the books again
+		index.broken = false
+		hits, total, err := store.SearchBooks(ctx, "dune", 0, 0)
+		require.NoError(t, err, name)
+		assert.Equal(t, 1, total, name)
+		require.Len(t, hits, 1, name)
+		assert.Equal(t, dune.ID, hits[0].Book.ID, name)
+	}
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+	"users-books-api-testing/config"
+	"users-books-api-testing/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// errRefreshTokenReused is returned from inside the rotation transaction so
+// that the family revocation can run after it has rolled back.
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+type gormTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewGormTokenRepository(db *gorm.DB) TokenRepository {
+	return &gormTokenRepository{db: db}
+}
+
+func (r *gormTokenRepository) CreateRefreshToken(ctx context.Context, userID uint) (string, error) {
+	token, row, err := newRefreshToken(userID)
+	if err != nil {
+		return "", err
+	}
+	if err := r.db.WithContext(ctx).Table("refresh_tokens").Create(&row).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (r *gormTokenRepository) RotateRefreshToken(ctx context.Context, token string) (uint, string, error) {
+	var current models.RefreshTokens
+	var next string
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Table("refresh_tokens").Where("token_hash = ?", hashToken(token)).First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if current.RevokedAt != nil {
+			return errRefreshTokenReused
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// the revoked_at guard makes two concurrent rotations of the same
+		// token race for a single row; the loser is treated as a reuse
+		res := tx.Table("refresh_tokens").
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		plain, row, err := newRefreshToken(current.UserID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Table("refresh_tokens").Create(&row).Error; err != nil {
+			return err
+		}
+		next = plain
+		return tx.Table("refresh_tokens").Where("id = ?", current.ID).Update("replaced_by_id", row.ID).Error
+	})
+
+	if errors.Is(err, errRefreshTokenReused) {
+		// a token that was already rotated is being replayed, so the whole
+		// chain may be in the wrong hands: log the user out everywhere
+		if err := r.RevokeUserRefreshTokens(ctx, current.UserID); err != nil {
+			return 0, "", err
+		}
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return current.UserID, next, nil
+}
+
+func (r *gormTokenRepository) RevokeRefreshToken(ctx context.Context, token string) error {
+	return r.db.WithContext(ctx).Table("refresh_tokens").
+		Where("token_hash = ? AND revoked_at IS NULL", hashToken(token)).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *gormTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Table("refresh_tokens").
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *gormTokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	revoked := models.RevokedTokens{JTI: jti, ExpiresAt: expiresAt}
+	if err := r.db.WithContext(ctx).Table("revoked_tokens").Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+		return err
+	}
+	// entries are only needed until the token would have expired anyway
+	return r.db.WithContext(ctx).Table("revoked_tokens").Where("expires_at < ?", time.Now()).Delete(&models.RevokedTokens{}).Error
+}
+
+func (r *gormTokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Table("revoked_tokens").Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func newRefreshToken(userID uint) (string, models.RefreshTokens, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", models.RefreshTokens{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, models.RefreshTokens{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(config.REFRESH_TOKEN_TTL),
+	}, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdatesWriteZeroValuesAndCheckVersions(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		book := models.Books{Title: "dune", Author: "frank herbert", Year: 1965}
+		require.NoError(t, store.Books.AddBook(ctx, &book), name)
+		assert.Equal(t, uint(1), book.Version, name)
+
+		first, err := store.Books.GetBookById(ctx, int(book.ID))
+		require.NoError(t, err, name)
+		second := first
+
+		first.Author, first.Year = "", 0
+		require.NoError(t, store.Books.UpdateBookById(ctx, int(book.ID), &first), name)
+		assert.Equal(t, uint(2), first.Version, name)
+		stored, err := store.Books.GetBookById(ctx, int(book.ID))
+		require.NoError(t, err, name)
+		assert.Equal(t, "", stored.Author, name)
+		assert.Equal(t, 0, stored.Year, name)
+		assert.Equal(t, uint(2), stored.Version, name)
+
+		second.Title = "children of dune"
+		assert.ErrorIs(t, store.Books.UpdateBookById(ctx, int(book.ID), &second), ErrStaleVersion, name)
+		assert.Equal(t, uint(1), second.Version, name, "a failed update leaves the version alone")
+
+		require.NoError(t, store.Books.DeleteBookById(ctx, int(book.ID)), name)
+		assert.ErrorIs(t, store.Books.UpdateBookById(ctx, int(book.ID), &stored), ErrNotFound, name)
+		require.NoError(t, store.Books.RestoreBookById(ctx, int(book.ID)), name)
+		stored, err = store.Books.GetBookById(ctx, int(book.ID))
+		require.NoError(t, err, name)
+		assert.Equal(t, uint(3), stored.Version, name, "restoring is a write too")
+
+		user := models.Users{Name: "paul", Email: "paul@example.com", Password: "arrakis 1"}
+		require.NoError(t, store.Users.CreateUser(ctx, &user), name)
+		current, err := store.Users.GetUserById(ctx, int(user.ID))
+		require.NoError(t, err, name)
+		current.Name = "muad'dib"
+		require.NoError(t, store.Users.UpdateUserById(ctx, int(user.ID), &current), name)
+		_, err = store.Users.LoginUser(ctx, &models.Users{Email: "paul@example.com", Password: "arrakis 1"})
+		assert.NoError(t, err, name, "an update without a password keeps the old one")
+		current.Version = 1
+		assert.ErrorIs(t, store.Users.UpdateUserById(ctx, int(user.ID), &current), ErrStaleVersion, name)
+	}
+}
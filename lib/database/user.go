@@ -1,68 +1,340 @@
 package database
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"time"
 	"users-books-api-testing/config"
 	"users-books-api-testing/middlewares"
 	"users-books-api-testing/models"
+
+	"gorm.io/gorm"
 )
 
-func CreateUser(user *models.Users) error {
-	if err := config.DB.Table("users").Create(&user).Error; err != nil {
+type gormUserRepository struct {
+	db     *gorm.DB
+	tokens TokenRepository
+}
+
+func NewGormUserRepository(db *gorm.DB, tokens TokenRepository) UserRepository {
+	return &gormUserRepository{db: db, tokens: tokens}
+}
+
+func (r *gormUserRepository) CreateUser(ctx context.Context, user *models.Users) error {
+	setDefaultRole(user)
+	normalizeEmail(user)
+	if err := setPassword(user); err != nil {
 		return err
 	}
+	user.Version = 1
+	if err := r.db.WithContext(ctx).Table("users").Create(&user).Error; err != nil {
+		return duplicateEmail(err)
+	}
 	return nil
 }
 
-func GetUsers() (interface{}, error) {
+func (r *gormUserRepository) GetUsers(ctx context.Context, filter UserFilter, opts ListOptions) ([]models.Users, Page, error) {
+	q, err := newListQuery(opts, userSortColumns)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	var total int64
+	if err := r.filtered(ctx, filter).Count(&total).Error; err != nil {
+		return nil, Page{}, err
+	}
+
 	var users []models.Users
+	if err := q.apply(r.filtered(ctx, filter)).Find(&users).Error; err != nil {
+		return nil, Page{}, err
+	}
+	n, page := q.page(total, len(users), func(i int) uint { return users[i].ID }, func(i int, column string) interface{} {
+		return userSortValue(users[i], column)
+	})
+	return users[:n], page, nil
+}
 
-	if err := config.DB.Table("users").Find(&users).Error; err != nil {
-		return nil, err
+func (r *gormUserRepository) filtered(ctx context.Context, filter UserFilter) *gorm.DB {
+	db := r.db.WithContext(ctx).Table("users")
+	if filter.IncludeDeleted {
+		db = db.Unscoped()
+	}
+	if filter.Name != "" {
+		db = db.Where("name LIKE ? ESCAPE '!'", likeContains(filter.Name))
+	}
+	if filter.Email != "" {
+		db = db.Where("email = ?", NormalizeEmail(filter.Email))
 	}
-	return users, nil
+	if filter.Role != "" {
+		db = db.Where("role = ?", filter.Role)
+	}
+	return db
 }
 
-func GetUserById(id int) (interface{}, error) {
+func (r *gormUserRepository) GetUserById(ctx context.Context, id int) (models.Users, error) {
 	var user models.Users
 
-	if err := config.DB.Table("users").First(&user, id).Error; err != nil {
-		return nil, err
+	if err := r.db.WithContext(ctx).Table("users").First(&user, id).Error; err != nil {
+		return models.Users{}, translate(err)
 	}
 	return user, nil
 }
 
-func UpdateUserById(id int, user *models.Users) error {
-	var users models.Users
-	if err := config.DB.Table("users").First(&users, id).Error; err != nil {
+func (r *gormUserRepository) UpdateUserById(ctx context.Context, id int, user *models.Users) error {
+	normalizeEmail(user)
+	if err := setPassword(user); err != nil {
 		return err
 	}
-	err := config.DB.Table("users").Where("id = ?", id).Updates(user).Error
-	if err != nil {
+	columns := []string{"name", "email", "role"}
+	if user.PasswordHash != "" {
+		columns = append(columns, "password")
+	}
+
+	var stored models.Users
+	if err := r.db.WithContext(ctx).Table("users").Select("role").First(&stored, id).Error; err != nil {
+		return translate(err)
+	}
+	if err := duplicateEmail(update(r.db.WithContext(ctx), "users", id, user, &user.Version, columns...)); err != nil {
 		return err
 	}
-	return nil
+	if stored.Role == user.Role {
+		return nil
+	}
+	// read the token after the update, so that one issued in between is
+	// ended too
+	if err := r.db.WithContext(ctx).Table("users").Select("id", "token").First(&stored, id).Error; err != nil {
+		return translate(err)
+	}
+	return endSessions(ctx, stored, r.tokens)
 }
 
-func DeleteUserById(id int) error {
+func (r *gormUserRepository) DeleteUserById(ctx context.Context, id int) error {
 	var user models.Users
-	if err := config.DB.Table("users").Where("id = ?", id).Delete(&user).Error; err != nil {
-		return err
+	result := r.db.WithContext(ctx).Table("users").Where("id = ?", id).Delete(&user)
+	if result.Error != nil {
+		return result.Error
 	}
-	return nil
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	// read the token after the delete, so that one issued in between is
+	// ended too
+	if err := r.db.WithContext(ctx).Unscoped().Table("users").Select("id", "token").First(&user, id).Error; err != nil {
+		return translate(err)
+	}
+	return endSessions(ctx, user, r.tokens)
 }
 
-func LoginUser(user *models.Users) (interface{}, error){
-	var err error
-	err = config.DB.Where("email = ? AND password = ?", user.Email, user.Password).Error
-	if err != nil {
-		return nil, err
+func (r *gormUserRepository) RestoreUserById(ctx context.Context, id int) error {
+	return restore(r.db.WithContext(ctx), "users", id)
+}
+
+func (r *gormUserRepository) PurgeUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		borrowing := tx.Table("loans").Select("user_id").Where("returned_at IS NULL")
+		var ids []uint
+		if err := tx.Table("users").Where("deleted_at < ? AND id NOT IN (?)", deletedBefore, borrowing).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for len(ids) > 0 {
+			n := len(ids)
+			if n > idsPerQuery {
+				n = idsPerQuery
+			}
+			// deleted_at is checked again for users restored meanwhile, who
+			// keep their loans
+			result := tx.Unscoped().Where("id IN ? AND deleted_at < ?", ids[:n], deletedBefore).Delete(&models.Users{})
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+			err := tx.Table("loans").Where("user_id IN ? AND user_id NOT IN (?)", ids[:n], tx.Table("users").Select("id")).
+				Delete(&models.Loans{}).Error
+			if err != nil {
+				return err
+			}
+			ids = ids[n:]
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (r *gormUserRepository) LoginUser(ctx context.Context, user *models.Users) (models.Users, error) {
+	var found models.Users
+	err := r.db.WithContext(ctx).Table("users").Where("email = ?", NormalizeEmail(user.Email)).First(&found).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Users{}, rejectLogin(user.Password)
 	}
-	user.Token, err = middlewares.CreateToken(int(user.ID))
 	if err != nil {
-		return nil, err
+		return models.Users{}, err
+	}
+
+	stored := found.PasswordHash
+	if err := authenticate(&found, user.Password); err != nil {
+		return models.Users{}, err
+	}
+	if err := issueToken(ctx, &found, r.tokens); err != nil {
+		return models.Users{}, err
 	}
-	if err := config.DB.Save(user).Error; err != nil {
-		return nil, err
+	// write only what logging in changed, so an update made meanwhile
+	// isn't overwritten
+	if err := r.db.WithContext(ctx).Table("users").Where("id = ?", found.ID).Update("token", found.Token).Error; err != nil {
+		return models.Users{}, err
+	}
+	if found.PasswordHash != stored {
+		// unless the password itself was changed meanwhile
+		result := r.db.WithContext(ctx).Table("users").Where("id = ? AND password = ?", found.ID, stored).
+			Updates(map[string]interface{}{"password": found.PasswordHash, "updated_at": time.Now(), "version": gorm.Expr("version + 1")})
+		if result.Error != nil {
+			return models.Users{}, result.Error
+		}
+		if result.RowsAffected == 1 {
+			found.Version++
+		}
+	}
+	return found, nil
+}
+
+func (r *gormUserRepository) RefreshUserToken(ctx context.Context, id int) (models.Users, error) {
+	var user models.Users
+	if err := r.db.WithContext(ctx).Table("users").First(&user, id).Error; err != nil {
+		return models.Users{}, translate(err)
+	}
+	if err := issueToken(ctx, &user, r.tokens); err != nil {
+		return models.Users{}, err
+	}
+	if err := r.db.WithContext(ctx).Table("users").Where("id = ?", id).Update("token", user.Token).Error; err != nil {
+		return models.Users{}, err
 	}
 	return user, nil
 }
+
+// authenticate checks password against the stored user, upgrading a plain
+// text password to a hash. The caller persists the changes made to user.
+func authenticate(user *models.Users, password string) error {
+	ok, needsRehash := checkPassword(user.PasswordHash, password)
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	if needsRehash {
+		user.Password = password
+		return setPassword(user)
+	}
+	return nil
+}
+
+// issueToken replaces user.Token with a new access token and puts the one
+// it supersedes on the denylist. The caller persists user.Token.
+func issueToken(ctx context.Context, user *models.Users, tokens TokenRepository) error {
+	if err := revokeAccessToken(ctx, user.Token, tokens); err != nil {
+		return err
+	}
+
+	token, err := middlewares.CreateToken(int(user.ID), user.Role)
+	if err != nil {
+		return err
+	}
+	user.Token = token
+	return nil
+}
+
+// endSessions revokes the access token and the refresh tokens of user, whose
+// role changed or who was deleted, so their tokens can't outlive that.
+// Earlier access tokens were revoked when user.Token superseded them.
+func endSessions(ctx context.Context, user models.Users, tokens TokenRepository) error {
+	if err := revokeAccessToken(ctx, user.Token, tokens); err != nil {
+		return err
+	}
+	return tokens.RevokeUserRefreshTokens(ctx, user.ID)
+}
+
+func revokeAccessToken(ctx context.Context, token string, tokens TokenRepository) error {
+	if token == "" {
+		return nil
+	}
+	// an already expired or otherwise unusable token needs no revoking
+	jti, exp, err := middlewares.ParseTokenID(token)
+	if err != nil || jti == "" {
+		return nil
+	}
+	return tokens.RevokeAccessToken(ctx, jti, exp)
+}
+
+// rejectLogin burns the same bcrypt work as a real check for an unknown
+// email, so response times don't reveal which accounts exist.
+func rejectLogin(password string) error {
+	checkPassword(string(dummyHash), password)
+	return ErrInvalidCredentials
+}
+
+func matchUser(user models.Users, filter UserFilter) bool {
+	if filter.Name != "" && !containsFold(user.Name, filter.Name) {
+		return false
+	}
+	if filter.Email != "" && user.Email != NormalizeEmail(filter.Email) {
+		return false
+	}
+	if filter.Role != "" && user.Role != filter.Role {
+		return false
+	}
+	return true
+}
+
+func userSortValue(user models.Users, column string) interface{} {
+	switch column {
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	case "created_at":
+		return user.CreatedAt
+	default:
+		return int(user.ID)
+	}
+}
+
+// setDefaultRole makes new accounts members unless a role was set on
+// purpose.
+func setDefaultRole(user *models.Users) {
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+}
+
+// normalizeEmail lower-cases the email so the unique index can't be dodged
+// by changing its case.
+func normalizeEmail(user *models.Users) {
+	user.Email = NormalizeEmail(user.Email)
+}
+
+// NormalizeEmail returns email the way it is stored.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// duplicateEmail reports a violated unique index on users, of which email is
+// the only one, as ErrDuplicateEmail.
+func duplicateEmail(err error) error {
+	if config.IsDuplicateKey(err) {
+		return ErrDuplicateEmail
+	}
+	return translate(err)
+}
+
+// setPassword hashes the plain text password taken from the request into
+// PasswordHash and clears it, so it is neither stored nor echoed back.
+func setPassword(user *models.Users) error {
+	if user.Password == "" {
+		return nil
+	}
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	user.Password = ""
+	return nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"users-books-api-testing/middlewares"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleChangeRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		user := models.Users{Name: "leto", Email: "leto@example.com", Password: "arrakis 1", Role: models.RoleAdmin}
+		require.NoError(t, store.Users.CreateUser(ctx, &user), name)
+		session, err := store.Users.LoginUser(ctx, &models.Users{Email: "leto@example.com", Password: "arrakis 1"})
+		require.NoError(t, err, name)
+		refresh, err := store.Tokens.CreateRefreshToken(ctx, user.ID)
+		require.NoError(t, err, name)
+		jti, _, err := middlewares.ParseTokenID(session.Token)
+		require.NoError(t, err, name)
+
+		// other changes leave the tokens alone
+		current, err := store.Users.GetUserById(ctx, int(user.ID))
+		require.NoError(t, err, name)
+		current.Name = "leto atreides"
+		require.NoError(t, store.Users.UpdateUserById(ctx, int(user.ID), &current), name)
+		revoked, err := store.Tokens.IsAccessTokenRevoked(ctx, jti)
+		require.NoError(t, err, name)
+		assert.False(t, revoked, name)
+
+		current.Role = models.RoleMember
+		require.NoError(t, store.Users.UpdateUserById(ctx, int(user.ID), &current), name)
+		revoked, err = store.Tokens.IsAccessTokenRevoked(ctx, jti)
+		require.NoError(t, err, name)
+		assert.True(t, revoked, name)
+		_, _, err = store.Tokens.RotateRefreshToken(ctx, refresh)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken, name)
+	}
+}
+
+func TestLoginRehashBumpsVersion(t *testing.T) {
+	ctx := context.Background()
+	gormStore, db := newSQLiteStore(t)
+	memoryStore := NewMemoryStore()
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": memoryStore} {
+		user := models.Users{Name: "jessica", Email: "jessica@example.com", Password: "bene gesserit"}
+		require.NoError(t, store.Users.CreateUser(ctx, &user), name)
+		// a password stored before passwords were hashed
+		if name == "gorm" {
+			require.NoError(t, db.Table("users").Where("id = ?", user.ID).Update("password", "bene gesserit").Error)
+		} else {
+			users := store.Users.(*memoryUserRepository)
+			row := users.rows[user.ID]
+			row.PasswordHash = "bene gesserit"
+			users.rows[user.ID] = row
+		}
+		before, err := store.Users.GetUserById(ctx, int(user.ID))
+		require.NoError(t, err, name)
+
+		session, err := store.Users.LoginUser(ctx, &models.Users{Email: "jessica@example.com", Password: "bene gesserit"})
+		require.NoError(t, err, name)
+		assert.Equal(t, before.Version+1, session.Version, name)
+		after, err := store.Users.GetUserById(ctx, int(user.ID))
+		require.NoError(t, err, name)
+		assert.Equal(t, before.Version+1, after.Version, name)
+		assert.Equal(t, session.Token, after.Token, name)
+
+		// an update made against the version read before the rehash is stale
+		before.Name = "lady jessica"
+		assert.ErrorIs(t, store.Users.UpdateUserById(ctx, int(user.ID), &before), ErrStaleVersion, name)
+
+		// logging in again leaves the version alone
+		session, err = store.Users.LoginUser(ctx, &models.Users{Email: "jessica@example.com", Password: "bene gesserit"})
+		require.NoError(t, err, name)
+		assert.Equal(t, after.Version, session.Version, name)
+	}
+}
+
+func TestDeleteUserRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	gormStore, _ := newSQLiteStore(t)
+
+	for name, store := range map[string]*Store{"gorm": gormStore, "memory": NewMemoryStore()} {
+		user := models.Users{Name: "paul", Email: "paul@example.com", Password: "muad'dib"}
+		require.NoError(t, store.Users.CreateUser(ctx, &user), name)
+		session, err := store.Users.LoginUser(ctx, &models.Users{Email: "paul@example.com", Password: "muad'dib"})
+		require.NoError(t, err, name)
+		refresh, err := store.Tokens.CreateRefreshToken(ctx, user.ID)
+		require.NoError(t, err, name)
+		jti, _, err := middlewares.ParseTokenID(session.Token)
+		require.NoError(t, err, name)
+
+		require.NoError(t, store.Users.DeleteUserById(ctx, int(user.ID)), name)
+		assert.ErrorIs(t, store.Users.DeleteUserById(ctx, int(user.ID)), ErrNotFound, name)
+		assert.ErrorIs(t, store.Users.DeleteUserById(ctx, 999), ErrNotFound, name)
+		revoked, err := store.Tokens.IsAccessTokenRevoked(ctx, jti)
+		require.NoError(t, err, name)
+		assert.True(t, revoked, name)
+		_, _, err = store.Tokens.RotateRefreshToken(ctx, refresh)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken, name)
+	}
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"users-books-api-testing/lib/migrate"
+
+	"gorm.io/gorm"
+)
+
+// Version is the build version reported by the readiness probe. Release
+// builds set it with
+//
+//	go build -ldflags "-X users-books-api-testing/lib/health.Version=v1.2.3"
+var Version = "dev"
+
+// Check is one dependency the service needs to serve traffic. Run returns
+// nil while the dependency is usable.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// DB checks that the database answers a ping.
+func DB(db *gorm.DB) Check {
+	return Check{Name: "database", Run: func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}}
+}
+
+// Migrations checks that the schema is up to date, so the code doesn't run
+// against tables it doesn't know.
+func Migrations(m *migrate.Migrator) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending, the first is %s", len(pending), pending[0])
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// SlowQueryThreshold is how long a statement runs before it is logged as a
+// warning.
+const SlowQueryThreshold = 200 * time.Millisecond
+
+// Gorm is a GORM logger that writes through the logger of the request a
+// statement runs for, so every statement carries its request ID. Statements
+// are logged at debug level, slow ones as warnings and failed ones as errors.
+type Gorm struct{}
+
+func (g Gorm) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	// the level is taken from the zerolog logger instead
+	return g
+}
+
+func (Gorm) Info(ctx context.Context, msg string, data ...interface{}) {
+	FromContext(ctx).Info().Msg(fmt.Sprintf(msg, data...))
+}
+
+func (Gorm) Warn(ctx context.Context, msg string, data ...interface{}) {
+	FromContext(ctx).Warn().Msg(fmt.Sprintf(msg, data...))
+}
+
+func (Gorm) Error(ctx context.Context, msg string, data ...interface{}) {
+	FromContext(ctx).Error().Msg(fmt.Sprintf(msg, data...))
+}
+
+func (Gorm) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	logger := FromContext(ctx)
+	took := time.Since(begin)
+
+	event := logger.Debug()
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		event = logger.Error().Err(err)
+	case took > SlowQueryThreshold:
+		event = logger.Warn().Bool("slow", true)
+	}
+	if !event.Enabled() {
+		return
+	}
+
+	sql, rows := fc()
+	event.Str("sql", redactLiterals(sql)).Int64("rows", rows).Dur("took_ms", took).Msg("query")
+}
+
+// stringLiteral matches the quoted values GORM interpolates into the SQL it
+// logs; identifiers are quoted with backticks, which it leaves alone.
+var stringLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+
+// redactLiterals replaces string values with ?, so password hashes, tokens
+// and personal data stay out of the logs.
+func redactLiterals(sql string) string {
+	return stringLiteral.ReplaceAllString(sql, "?")
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// base is the process wide logger. Requests log through a child of it that
+// carries their request ID.
+var base = zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+func init() {
+	// packages still using the standard logger end up in the same stream
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{})
+}
+
+// stdWriter writes the lines of the standard logger at info level.
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	base.Info().Msg(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// SetLevel sets the minimum level written, one of trace, debug, info, warn
+// or error.
+func SetLevel(level string) error {
+	l, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return err
+	}
+	base = base.Level(l)
+	return nil
+}
+
+// Logger returns the process wide logger, for logs that belong to no
+// request.
+func Logger() *zerolog.Logger {
+	return &base
+}
+
+type contextKey struct{}
+
+type requestLogger struct {
+	logger    zerolog.Logger
+	requestID string
+}
+
+// WithRequestID returns a copy of ctx whose logger tags everything it writes
+// with requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestLogger{
+		logger:    base.With().Str("request_id", requestID).Logger(),
+		requestID: requestID,
+	})
+}
+
+// FromContext returns the logger of the request ctx belongs to, or the
+// process wide logger outside of requests.
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if ctx != nil {
+		if rl, ok := ctx.Value(contextKey{}).(requestLogger); ok {
+			return &rl.logger
+		}
+	}
+	return &base
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	if ctx != nil {
+		if rl, ok := ctx.Value(contextKey{}).(requestLogger); ok {
+			return rl.requestID
+		}
+	}
+	return ""
+}
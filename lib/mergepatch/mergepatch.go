@@ -0,0 +1,48 @@
+// Package mergepatch applies JSON Merge Patches (RFC 7396): a patch is a
+// JSON document shaped like the target, in which members set to null are
+// removed and the others replace the target's, objects being merged member
+// by member.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ContentType is the media type of merge patch request bodies.
+const ContentType = "application/merge-patch+json"
+
+// ErrInvalid is returned for patches that aren't JSON.
+var ErrInvalid = errors.New("the patch is not valid JSON")
+
+// Apply returns doc with patch merged into it. doc must be valid JSON.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, ErrInvalid
+	}
+	var d interface{}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(d, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = merge(object[name], value)
+	}
+	return object
+}
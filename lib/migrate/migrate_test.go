@@ -0,0 +1,109 @@
+package migrate_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"users-books-api-testing/config"
+	"users-books-api-testing/lib/migrate"
+	"users-books-api-testing/migrations"
+	"users-books-api-testing/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db, err := config.Open("sqlite://" + filepath.Join(t.TempDir(), "migrate.db"))
+	require.NoError(t, err)
+	m, err := migrate.New(db, migrations.FS)
+	require.NoError(t, err)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	all := len(statuses)
+	assert.NotZero(t, all)
+
+	applied, err := m.Up()
+	require.NoError(t, err)
+	assert.Len(t, applied, all)
+	for _, table := range []string{"users", "books", "refresh_tokens", "revoked_tokens", "authors", "book_authors", "loans"} {
+		assert.True(t, db.Migrator().HasTable(table), table)
+	}
+	pending, err := m.Pending(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = m.Pending(canceled)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the unique email index from the latest migration is enforced
+	require.NoError(t, db.Exec("INSERT INTO users (email) VALUES ('a@example.com')").Error)
+	assert.True(t, config.IsDuplicateKey(db.Exec("INSERT INTO users (email) VALUES ('a@example.com')").Error))
+	assert.True(t, db.Migrator().HasColumn(&models.Books{}, "version"))
+	assert.True(t, db.Migrator().HasColumn(&models.Books{}, "copies"))
+
+	// SQLite rebuilds books to drop copies, keeping version
+	_, err = m.Down(1)
+	require.NoError(t, err)
+	assert.False(t, db.Migrator().HasTable("loans"))
+	assert.False(t, db.Migrator().HasColumn(&models.Books{}, "copies"))
+	assert.True(t, db.Migrator().HasColumn(&models.Books{}, "version"))
+
+	// authors are backfilled from the bylines of the books, deleted or not
+	_, err = m.Down(1)
+	require.NoError(t, err)
+	assert.False(t, db.Migrator().HasTable("authors"))
+	require.NoError(t, db.Exec(`INSERT INTO books (title, author) VALUES
+		('dune', 'Frank Herbert'), ('dune messiah', ' Frank Herbert '), ('untitled', ''), ('hyperion', 'Dan Simmons')`).Error)
+	require.NoError(t, db.Exec("UPDATE books SET deleted_at = CURRENT_TIMESTAMP WHERE title = 'hyperion'").Error)
+	_, err = m.Up()
+	require.NoError(t, err)
+	var authors []string
+	require.NoError(t, db.Table("authors").Order("id").Pluck("name", &authors).Error)
+	assert.Equal(t, []string{"Frank Herbert", "Dan Simmons"}, authors)
+	var links []models.BookAuthors
+	require.NoError(t, db.Table("book_authors").Order("book_id").Find(&links).Error)
+	assert.Equal(t, []models.BookAuthors{{BookID: 1, AuthorID: 1}, {BookID: 2, AuthorID: 1}, {BookID: 4, AuthorID: 2}}, links)
+
+	// SQLite rebuilds the tables to drop version, keeping rows and indexes
+	_, err = m.Down(3)
+	require.NoError(t, err)
+	assert.False(t, db.Migrator().HasColumn(&models.Users{}, "version"))
+	assert.True(t, config.IsDuplicateKey(db.Exec("INSERT INTO users (email) VALUES ('a@example.com')").Error))
+	_, err = m.Up()
+	require.NoError(t, err)
+
+	rolledBack, err := m.Down(all)
+	require.NoError(t, err)
+	assert.Len(t, rolledBack, all)
+	assert.Equal(t, applied[0], rolledBack[all-1])
+	assert.False(t, db.Migrator().HasTable("users"))
+
+	// and everything can be applied again
+	applied, err = m.Up()
+	require.NoError(t, err)
+	assert.Len(t, applied, all)
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sqlite"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sqlite", "0007_old.up.sql"), []byte("SELECT 1;"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sqlite", "0007_old.down.sql"), []byte("SELECT 1;"), 0o644))
+
+	paths, err := migrate.Create(dir, "Add Loans!", []string{"mysql", "sqlite"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "mysql", "0008_add_loans.up.sql"),
+		filepath.Join(dir, "mysql", "0008_add_loans.down.sql"),
+		filepath.Join(dir, "sqlite", "0008_add_loans.up.sql"),
+		filepath.Join(dir, "sqlite", "0008_add_loans.down.sql"),
+	}, paths)
+
+	loaded, err := migrate.Load(os.DirFS(filepath.Join(dir, "mysql")))
+	require.NoError(t, err)
+	assert.Equal(t, "0008_add_loans", loaded[0].String())
+}
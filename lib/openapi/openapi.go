@@ -0,0 +1,305 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Document is an OpenAPI 3 document, with just the parts of the format this
+// API uses.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps lower case HTTP methods to the operation they perform.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Headers     map[string]*Header   `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	WriteOnly            bool               `json:"writeOnly,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// SecurityRequirement maps a security scheme name to the scopes it needs.
+type SecurityRequirement map[string][]string
+
+// New returns an empty document.
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			Responses:       map[string]*Response{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}
+}
+
+// Add documents the operation served for method on path, which is given in
+// echo's syntax (/books/:id).
+func (d *Document) Add(method, path string, op *Operation) {
+	path = Path(path)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// Operation returns the operation documented for method on path, which is
+// given in echo's syntax, or nil.
+func (d *Document) Operation(method, path string) *Operation {
+	return d.Paths[Path(path)][strings.ToLower(method)]
+}
+
+var echoParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// Path turns an echo route path (/books/:id) into an OpenAPI one
+// (/books/{id}).
+func Path(path string) string {
+	return echoParam.ReplaceAllString(path, "{$1}")
+}
+
+// Ref returns a schema pointing at the named component schema.
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ResponseRef returns a response pointing at the named component response.
+func ResponseRef(name string) *Response {
+	return &Response{Ref: "#/components/responses/" + name}
+}
+
+// JSON wraps schema as the application/json content of a body.
+func JSON(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// Object returns an object schema with the given properties.
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// ArrayOf returns an array schema of items.
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Type returns a schema for a plain type such as "string" or "integer".
+func Type(typ string) *Schema {
+	return &Schema{Type: typ}
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	deletedAtType   = reflect.TypeOf(gorm.DeletedAt{})
+	validateIntArgs = regexp.MustCompile(`^\d+$`)
+)
+
+// SchemaOf derives an object schema from the struct v the way encoding/json
+// serializes it, taking formats, limits and required fields from its
+// validate tags.
+func SchemaOf(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	schema := Object(map[string]*Schema{})
+	addFields(schema, t)
+	return schema
+}
+
+func addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(schema, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaOfType(field.Type)
+		if applyRules(property, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+func schemaOfType(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema *Schema
+	switch {
+	case t == timeType:
+		schema = &Schema{Type: "string", Format: "date-time"}
+	case t == deletedAtType:
+		schema = &Schema{Type: "string", Format: "date-time", Nullable: true}
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			schema = Type("string")
+		case reflect.Bool:
+			schema = Type("boolean")
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			schema = Type("integer")
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			schema = &Schema{Type: "integer", Minimum: float(0)}
+		case reflect.Float32, reflect.Float64:
+			schema = Type("number")
+		case reflect.Slice, reflect.Array:
+			schema = ArrayOf(schemaOfType(t.Elem()))
+		case reflect.Map:
+			schema = &Schema{Type: "object", AdditionalProperties: schemaOfType(t.Elem())}
+		case reflect.Struct:
+			schema = Object(map[string]*Schema{})
+			addFields(schema, t)
+		default:
+			schema = &Schema{}
+		}
+	}
+	if nullable {
+		schema.Nullable = true
+	}
+	return schema
+}
+
+// applyRules documents the validate rules on schema and reports whether the
+// field is required.
+func applyRules(schema *Schema, rules string) bool {
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "password":
+			schema.Format = "password"
+			schema.MinLength = integer(8)
+			schema.WriteOnly = true
+			schema.Description = "at least 8 characters with a letter and a digit"
+		case "year":
+			schema.Minimum = float(1)
+			schema.Description = "no later than next year"
+		case "max":
+			if validateIntArgs.MatchString(arg) && schema.Type == "string" {
+				n, _ := strconv.Atoi(arg)
+				schema.MaxLength = integer(n)
+			}
+		case "oneof":
+			for _, value := range strings.Fields(arg) {
+				schema.Enum = append(schema.Enum, value)
+			}
+		}
+	}
+	return required
+}
+
+func integer(n int) *int {
+	return &n
+}
+
+func float(f float64) *float64 {
+	return &f
+}
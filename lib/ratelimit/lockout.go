@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Lockout locks keys, typically accounts, out after a number of failures in
+// a row. The first lockout lasts a set duration and each one after it twice
+// as long as the previous, up to a maximum, until a success or Unlock starts
+// over. A key is forgotten once it has been unlocked and without failures
+// for the maximum duration.
+type Lockout struct {
+	threshold   int
+	duration    time.Duration
+	maxDuration time.Duration
+
+	mu        sync.Mutex
+	accounts  map[string]*lockState
+	lastSweep time.Time
+	now       Clock
+}
+
+type lockState struct {
+	failures    int
+	lockouts    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+// NewLockout returns a lockout after threshold failures. A threshold of
+// zero or less never locks anything.
+func NewLockout(threshold int, duration, maxDuration time.Duration) *Lockout {
+	if maxDuration < duration {
+		maxDuration = duration
+	}
+	return &Lockout{
+		threshold:   threshold,
+		duration:    duration,
+		maxDuration: maxDuration,
+		accounts:    map[string]*lockState{},
+		now:         time.Now,
+	}
+}
+
+// SetClock makes l read the time from now.
+func (l *Lockout) SetClock(now Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
+
+// Locked returns how long key stays locked, zero if it isn't.
+func (l *Lockout) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.state(key)
+	if !ok {
+		return 0
+	}
+	if remaining := state.lockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Fail records a failure on key. If that locks it, Fail returns for how
+// long.
+func (l *Lockout) Fail(key string) time.Duration {
+	if l.threshold <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	state, ok := l.state(key)
+	if !ok {
+		state = &lockState{}
+		l.accounts[key] = state
+	}
+	state.failures++
+	state.lastFailure = now
+	if state.failures < l.threshold {
+		return 0
+	}
+
+	duration := l.duration << uint(state.lockouts)
+	if duration > l.maxDuration || duration <= 0 {
+		duration = l.maxDuration
+	}
+	state.failures = 0
+	state.lockouts++
+	state.lockedUntil = now.Add(duration)
+	return duration
+}
+
+// Succeed clears key's failures and lockouts.
+func (l *Lockout) Succeed(key string) {
+	l.Unlock(key)
+}
+
+// Unlock lifts any lockout on key and clears its history.
+func (l *Lockout) Unlock(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.accounts, key)
+}
+
+// state returns the state of key unless it is stale, sweeping out stale
+// states every so often. l.mu must be held.
+func (l *Lockout) state(key string) (*lockState, bool) {
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepEvery {
+		for k, state := range l.accounts {
+			if l.stale(state, now) {
+				delete(l.accounts, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	state, ok := l.accounts[key]
+	if ok && l.stale(state, now) {
+		delete(l.accounts, key)
+		return nil, false
+	}
+	return state, ok
+}
+
+// stale reports whether state has been unlocked and without failures for
+// the maximum lockout duration.
+func (l *Lockout) stale(state *lockState, now time.Time) bool {
+	idleSince := state.lastFailure
+	if state.lockedUntil.After(idleSince) {
+		idleSince = state.lockedUntil
+	}
+	return now.Sub(idleSince) >= l.maxDuration
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time. Stores, limiters and lockouts read time.Now unless
+// given another clock with SetClock, as tests do.
+type Clock func() time.Time
+
+// Store counts hits per key over fixed windows.
+type Store interface {
+	// Incr records a hit on key and returns the hits so far in the current
+	// window, which starts with the first hit and lasts window, and when it
+	// ends.
+	Incr(key string, window time.Duration) (int, time.Time)
+	// Reset forgets the hits on key.
+	Reset(key string)
+}
+
+// MemoryStore is a Store for a single process. Expired windows are swept
+// out as new hits come in.
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+	now       Clock
+}
+
+type counter struct {
+	hits  int
+	reset time.Time
+}
+
+// sweepEvery is how often Incr drops expired counters.
+const sweepEvery = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: map[string]*counter{}, now: time.Now}
+}
+
+// SetClock makes s read the time from now.
+func (s *MemoryStore) SetClock(now Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+func (s *MemoryStore) Incr(key string, window time.Duration) (int, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepEvery {
+		for k, c := range s.counters {
+			if !now.Before(c.reset) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &counter{reset: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.hits++
+	return c.hits, c.reset
+}
+
+func (s *MemoryStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+}
+
+// Rule allows Limit hits per Window. A Limit of zero or less allows
+// everything.
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Limiter enforces a Rule on the keys it is given, counting hits in a Store
+// it may share with other limiters.
+type Limiter struct {
+	store  Store
+	prefix string
+	rule   Rule
+	now    Clock
+}
+
+// NewLimiter returns a limiter counting in store under keys prefixed with
+// prefix, so limiters sharing a store keep apart.
+func NewLimiter(store Store, prefix string, rule Rule) *Limiter {
+	return &Limiter{store: store, prefix: prefix, rule: rule, now: time.Now}
+}
+
+// SetClock makes l read the time from now. It should be the clock of its
+// store, which sets when windows end.
+func (l *Limiter) SetClock(now Clock) {
+	l.now = now
+}
+
+// Allow records a hit on key and reports whether it is within the limit.
+// When it is not, it also returns how long until the window ends.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.rule.Limit <= 0 {
+		return true, 0
+	}
+	hits, reset := l.store.Incr(l.prefix+key, l.rule.Window)
+	if hits <= l.rule.Limit {
+		return true, 0
+	}
+	return false, reset.Sub(l.now())
+}
+
+// Reset clears the hits on key.
+func (l *Limiter) Reset(key string) {
+	l.store.Reset(l.prefix + key)
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a settable time source for the store and lockout.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func TestMemoryStoreWindows(t *testing.T) {
+	clk := &clock{t: time.Unix(1000, 0)}
+	store := NewMemoryStore()
+	store.now = clk.now
+
+	hits, reset := store.Incr("a", time.Minute)
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, clk.t.Add(time.Minute), reset)
+
+	clk.t = clk.t.Add(30 * time.Second)
+	hits, reset = store.Incr("a", time.Minute)
+	assert.Equal(t, 2, hits)
+	assert.Equal(t, time.Unix(1060, 0), reset, "the window starts with the first hit")
+
+	hits, _ = store.Incr("b", time.Minute)
+	assert.Equal(t, 1, hits, "keys are counted apart")
+
+	clk.t = clk.t.Add(30 * time.Second)
+	hits, _ = store.Incr("a", time.Minute)
+	assert.Equal(t, 1, hits, "a new window starts once the last one ended")
+
+	store.Reset("a")
+	hits, _ = store.Incr("a", time.Minute)
+	assert.Equal(t, 1, hits)
+}
+
+func TestLimiter(t *testing.T) {
+	store := NewMemoryStore()
+	limiter := NewLimiter(store, "ip:", Rule{Limit: 2, Window: time.Minute})
+	other := NewLimiter(store, "email:", Rule{Limit: 2, Window: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		ok, _ := limiter.Allow("x")
+		assert.True(t, ok)
+	}
+	ok, wait := limiter.Allow("x")
+	assert.False(t, ok)
+	assert.True(t, wait > 0 && wait <= time.Minute, wait)
+
+	ok, _ = other.Allow("x")
+	assert.True(t, ok, "limiters sharing a store count apart")
+
+	limiter.Reset("x")
+	ok, _ = limiter.Allow("x")
+	assert.True(t, ok)
+
+	unlimited := NewLimiter(store, "none:", Rule{})
+	for i := 0; i < 10; i++ {
+		ok, _ = unlimited.Allow("x")
+		assert.True(t, ok)
+	}
+}
+
+func TestLockoutDoublesUpToTheMaximum(t *testing.T) {
+	clk := &clock{t: time.Unix(1000, 0)}
+	lockout := NewLockout(2, time.Minute, 3*time.Minute)
+	lockout.now = clk.now
+
+	assert.Zero(t, lockout.Fail("a"))
+	assert.Zero(t, lockout.Locked("a"))
+	assert.Equal(t, time.Minute, lockout.Fail("a"))
+	assert.Equal(t, time.Minute, lockout.Locked("a"))
+
+	for _, expect := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		clk.t = clk.t.Add(lockout.Locked("a"))
+		assert.Zero(t, lockout.Locked("a"))
+		assert.Zero(t, lockout.Fail("a"))
+		assert.Equal(t, expect, lockout.Fail("a"))
+	}
+
+	lockout.Unlock("a")
+	assert.Zero(t, lockout.Locked("a"))
+	assert.Zero(t, lockout.Fail("a"))
+	assert.Equal(t, time.Minute, lockout.Fail("a"), "unlocking starts over")
+}
+
+func TestLockoutForgetsIdleKeys(t *testing.T) {
+	clk := &clock{t: time.Unix(1000, 0)}
+	lockout := NewLockout(2, time.Minute, time.Hour)
+	lockout.now = clk.now
+
+	lockout.Fail("a")
+	clk.t = clk.t.Add(time.Hour)
+	assert.Zero(t, lockout.Fail("a"), "the first failure was forgotten")
+
+	lockout.Succeed("a")
+	lockout.Fail("a")
+	assert.Equal(t, time.Minute, lockout.Fail("a"))
+	assert.Len(t, lockout.accounts, 1)
+
+	clk.t = clk.t.Add(2 * time.Hour)
+	lockout.Fail("b")
+	assert.Len(t, lockout.accounts, 1, "idle keys are swept out")
+}
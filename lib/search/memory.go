@@ -0,0 +1,257 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Ranking: documents are scored with BM25, per field, times the field's
+// weight. A query word's rarity is that of all the words it matches, and the
+// words it is only a prefix of, or a typo away from, count for a share of an
+// exact match, small enough that exact matches come first.
+const (
+	k1 = 1.2
+	b  = 0.75
+
+	prefixMatch = 0.3
+	typoMatch   = 0.2
+)
+
+// MemoryIndex is an inverted index kept in process memory. It only knows
+// about the documents put into it by this process.
+type MemoryIndex struct {
+	weights map[string]float64
+
+	mu   sync.RWMutex
+	docs map[uint]memoryDoc
+	// postings has, for each term, the documents it occurs in and how often
+	// in each of their fields.
+	postings map[string]map[uint]map[string]int
+	// terms are the keys of postings, sorted for prefix lookups.
+	terms []string
+	// words counts the words of each field over all documents.
+	words map[string]int
+}
+
+type memoryDoc struct {
+	fields map[string]string
+	tokens map[string][]token
+}
+
+// NewMemoryIndex returns an empty index that weighs matches in each field as
+// given in weights. Fields that aren't in weights weigh 1.
+func NewMemoryIndex(weights map[string]float64) *MemoryIndex {
+	return &MemoryIndex{
+		weights:  weights,
+		docs:     map[uint]memoryDoc{},
+		postings: map[string]map[uint]map[string]int{},
+		words:    map[string]int{},
+	}
+}
+
+func (x *MemoryIndex) Put(ctx context.Context, doc Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(doc.ID)
+	d := memoryDoc{fields: map[string]string{}, tokens: map[string][]token{}}
+	for field, text := range doc.Fields {
+		tokens := tokenize(text)
+		d.fields[field], d.tokens[field] = text, tokens
+		x.words[field] += len(tokens)
+		for _, t := range tokens {
+			x.post(t.term, doc.ID, field)
+		}
+	}
+	x.docs[doc.ID] = d
+	return nil
+}
+
+func (x *MemoryIndex) Remove(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(id)
+	return nil
+}
+
+// post must be called with x.mu held.
+func (x *MemoryIndex) post(term string, id uint, field string) {
+	docs, ok := x.postings[term]
+	if !ok {
+		docs = map[uint]map[string]int{}
+		x.postings[term] = docs
+		i := sort.SearchStrings(x.terms, term)
+		x.terms = append(x.terms, "")
+		copy(x.terms[i+1:], x.terms[i:])
+		x.terms[i] = term
+	}
+	if docs[id] == nil {
+		docs[id] = map[string]int{}
+	}
+	docs[id][field]++
+}
+
+// remove must be called with x.mu held.
+func (x *MemoryIndex) remove(id uint) {
+	d, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for field, tokens := range d.tokens {
+		x.words[field] -= len(tokens)
+		for _, t := range tokens {
+			docs, ok := x.postings[t.term]
+			if !ok {
+				continue
+			}
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(x.postings, t.term)
+				i := sort.SearchStrings(x.terms, t.term)
+				x.terms = append(x.terms[:i], x.terms[i+1:]...)
+			}
+		}
+	}
+	delete(x.docs, id)
+}
+
+func (x *MemoryIndex) Search(ctx context.Context, query string) ([]Hit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var words []string
+	seen := map[string]bool{}
+	for _, t := range tokenize(query) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			words = append(words, t.term)
+		}
+	}
+	if len(words) == 0 {
+		return []Hit{}, nil
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var scores map[uint]float64
+	// matched has the indexed terms that matched, by document
+	matched := map[uint]map[string]bool{}
+	for _, word := range words {
+		candidates := x.candidates(word)
+		idf := x.idf(candidates)
+		best := map[uint]float64{}
+		for term, quality := range candidates {
+			for id, counts := range x.postings[term] {
+				var score float64
+				for field, tf := range counts {
+					score += x.weight(field) * idf * x.saturate(field, tf, len(x.docs[id].tokens[field]))
+				}
+				if score *= quality; score > best[id] {
+					best[id] = score
+				}
+				if matched[id] == nil {
+					matched[id] = map[string]bool{}
+				}
+				matched[id][term] = true
+			}
+		}
+
+		// a document has to match every word
+		if scores == nil {
+			scores = best
+			continue
+		}
+		for id := range scores {
+			if score, ok := best[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		d := x.docs[id]
+		hit := Hit{ID: id, Score: score, Highlights: map[string]string{}}
+		for field, text := range d.fields {
+			if snippet := highlight(text, d.tokens[field], matched[id]); snippet != "" {
+				hit.Highlights[field] = snippet
+			}
+		}
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits, nil
+}
+
+// candidates returns the indexed terms word matches, with how good a match
+// each is. It must be called with x.mu held.
+func (x *MemoryIndex) candidates(word string) map[string]float64 {
+	found := map[string]float64{}
+	if _, ok := x.postings[word]; ok {
+		found[word] = 1
+	}
+	if utf8.RuneCountInString(word) >= 2 {
+		for i := sort.SearchStrings(x.terms, word); i < len(x.terms) && strings.HasPrefix(x.terms[i], word); i++ {
+			if x.terms[i] != word {
+				found[x.terms[i]] = prefixMatch
+			}
+		}
+	}
+	if typos := maxTypos(word); typos > 0 {
+		for _, term := range x.terms {
+			if _, ok := found[term]; !ok && withinDistance(word, term, typos) {
+				found[term] = typoMatch
+			}
+		}
+	}
+	return found
+}
+
+// idf is the inverse document frequency of the documents with any of terms.
+// It must be called with x.mu held.
+func (x *MemoryIndex) idf(terms map[string]float64) float64 {
+	docs := map[uint]bool{}
+	for term := range terms {
+		for id := range x.postings[term] {
+			docs[id] = true
+		}
+	}
+	n, df := float64(len(x.docs)), float64(len(docs))
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+func (x *MemoryIndex) weight(field string) float64 {
+	if w, ok := x.weights[field]; ok {
+		return w
+	}
+	return 1
+}
+
+// saturate is the BM25 term frequency part for a term occurring tf times in
+// a field of length words.
+func (x *MemoryIndex) saturate(field string, tf, length int) float64 {
+	avg := float64(x.words[field]) / float64(len(x.docs))
+	if avg == 0 {
+		avg = 1
+	}
+	return float64(tf) * (k1 + 1) / (float64(tf) + k1*(1-b+b*float64(length)/avg))
+}
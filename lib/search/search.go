@@ -0,0 +1,34 @@
+// Package search indexes short texts, such as titles and names, for full-text
+// queries. Index is what the rest of the application depends on; MemoryIndex
+// is an implementation that lives in process memory.
+package search
+
+import "context"
+
+// Document is a record as it is indexed: its id and its text, by field name.
+type Document struct {
+	ID     uint
+	Fields map[string]string
+}
+
+// Hit is a document that matched a query.
+type Hit struct {
+	ID    uint
+	Score float64
+	// Highlights has a snippet of each field that matched, HTML escaped,
+	// with the matching words in <em> tags.
+	Highlights map[string]string
+}
+
+// Index is a full-text index. Implementations must be safe for concurrent
+// use.
+type Index interface {
+	// Put adds doc, replacing the document with the same id if there is one.
+	Put(ctx context.Context, doc Document) error
+	// Remove drops the document with id. Unknown ids are ignored.
+	Remove(ctx context.Context, id uint) error
+	// Search returns the documents in which every word of query matches a
+	// word, best first. A query word matches the words it is a prefix of,
+	// and, if it is long enough, words a typo away from it.
+	Search(ctx context.Context, query string) ([]Hit, error)
+}
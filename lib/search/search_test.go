@@ -0,0 +1,120 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBooksIndex(t *testing.T) *MemoryIndex {
+	index := NewMemoryIndex(map[string]float64{"title": 2, "author": 1})
+	books := map[uint][2]string{
+		1: {"Dune", "Frank Herbert"},
+		2: {"Dune Messiah", "Frank Herbert"},
+		3: {"The Hobbit", "J. R. R. Tolkien"},
+		4: {"The Fellowship of the Ring", "J. R. R. Tolkien"},
+		5: {"Frankenstein", "Mary Shelley"},
+		6: {"Herbert West: <Reanimator>", "H. P. Lovecraft"},
+	}
+	for id, book := range books {
+		require.NoError(t, index.Put(context.Background(), Document{ID: id, Fields: map[string]string{
+			"title":  book[0],
+			"author": book[1],
+		}}))
+	}
+	return index
+}
+
+func ids(hits []Hit) []uint {
+	out := make([]uint, len(hits))
+	for i, hit := range hits {
+		out[i] = hit.ID
+	}
+	return out
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	index := newBooksIndex(t)
+
+	var testCases = []struct {
+		testName  string
+		query     string
+		expectIDs []uint
+	}{
+		{"exact word, shorter title first", "dune", []uint{1, 2}},
+		{"case and punctuation don't matter", "DUNE!", []uint{1, 2}},
+		{"every word must match", "dune messiah", []uint{2}},
+		{"across fields", "hobbit tolkien", []uint{3}},
+		{"title weighs more than author", "herbert", []uint{6, 1, 2}},
+		{"prefix", "fell", []uint{4}},
+		{"exact beats prefix", "frank", []uint{1, 2, 5}},
+		{"typo", "tolkein", []uint{3, 4}},
+		{"no short typos", "dome", []uint{}},
+		{"no match", "neuromancer", []uint{}},
+		{"no words", "?!", []uint{}},
+	}
+
+	for _, testCase := range testCases {
+		hits, err := index.Search(context.Background(), testCase.query)
+		if assert.NoError(t, err, testCase.testName) {
+			assert.Equal(t, testCase.expectIDs, ids(hits), testCase.testName)
+		}
+	}
+}
+
+func TestMemoryIndexHighlights(t *testing.T) {
+	index := newBooksIndex(t)
+
+	hits, err := index.Search(context.Background(), "herb rean")
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, map[string]string{"title": "<em>Herbert</em> West: &lt;<em>Reanimator</em>&gt;"}, hits[0].Highlights)
+
+	hits, err = index.Search(context.Background(), "frank")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"author": "<em>Frank</em> Herbert"}, hits[0].Highlights)
+	assert.Equal(t, map[string]string{"title": "<em>Frankenstein</em>"}, hits[2].Highlights)
+
+	long := strings.Repeat("word ", 60) + "needle " + strings.Repeat("word ", 60)
+	require.NoError(t, index.Put(context.Background(), Document{ID: 7, Fields: map[string]string{"title": long}}))
+	hits, err = index.Search(context.Background(), "needle")
+	require.NoError(t, err)
+	snippet := hits[0].Highlights["title"]
+	assert.True(t, strings.HasPrefix(snippet, "…"), snippet)
+	assert.True(t, strings.HasSuffix(snippet, "…"), snippet)
+	assert.Contains(t, snippet, "<em>needle</em>")
+	assert.Less(t, len(snippet), len(long))
+}
+
+func TestMemoryIndexPutAndRemove(t *testing.T) {
+	ctx := context.Background()
+	index := newBooksIndex(t)
+
+	require.NoError(t, index.Put(ctx, Document{ID: 1, Fields: map[string]string{"title": "Children of Dune"}}))
+	hits, err := index.Search(ctx, "children")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1}, ids(hits))
+	hits, err = index.Search(ctx, "frank")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2, 5}, ids(hits), "replaced documents lose their old words")
+
+	require.NoError(t, index.Remove(ctx, 2))
+	require.NoError(t, index.Remove(ctx, 99))
+	hits, err = index.Search(ctx, "dune")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1}, ids(hits))
+	assert.NotContains(t, index.terms, "messiah")
+}
+
+func TestWithinDistance(t *testing.T) {
+	assert.True(t, withinDistance("tolkien", "tolkien", 0))
+	assert.True(t, withinDistance("tolkein", "tolkien", 1), "a swap is one edit")
+	assert.True(t, withinDistance("hobit", "hobbit", 1))
+	assert.True(t, withinDistance("hobbits", "hobbit", 1))
+	assert.False(t, withinDistance("hobbit", "rabbit", 1))
+	assert.True(t, withinDistance("hobbit", "rabbit", 2))
+	assert.False(t, withinDistance("dune", "dunes and", 1))
+}
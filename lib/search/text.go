@@ -0,0 +1,163 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a word of a text: its lower-cased form and where it is.
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into words: runs of letters and digits.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// maxTypos is how many edits away from a query word an indexed word may be
+// and still match it. Short words get none: too many others are close.
+func maxTypos(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// withinDistance reports whether a and b are at most max edits apart, an
+// edit being an insertion, deletion or substitution of a letter or the swap
+// of two adjacent ones.
+func withinDistance(a, b string, max int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return false
+	}
+	// rows i-2, i-1 and i of the distance matrix
+	before := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && before[j-2]+1 < cur[j] {
+				cur[j] = before[j-2] + 1
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		// no later row can get back under the minimum of this one
+		if rowMin > max {
+			return false
+		}
+		before, prev, cur = prev, cur, before
+	}
+	return prev[len(rb)] <= max
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// snippetRunes is about how much of a field a highlight shows.
+const snippetRunes = 120
+
+// highlight returns text, HTML escaped, with the words whose terms are in
+// matched wrapped in <em> tags. Long texts are cut down to a window that
+// starts shortly before the first match.
+func highlight(text string, tokens []token, matched map[string]bool) string {
+	var hits []token
+	for _, t := range tokens {
+		if matched[t.term] {
+			hits = append(hits, t)
+		}
+	}
+	if len(hits) == 0 {
+		return ""
+	}
+
+	from, to := 0, len(text)
+	if utf8.RuneCountInString(text) > snippetRunes {
+		from = backRunes(text, hits[0].start, snippetRunes/4)
+		to = forwardRunes(text, from, snippetRunes)
+		if to < hits[0].end {
+			to = hits[0].end
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	at := from
+	for _, t := range hits {
+		if t.start < at || t.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[at:t.start]))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</em>")
+		at = t.end
+	}
+	b.WriteString(html.EscapeString(text[at:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// backRunes returns the byte offset n runes before i in text, or 0.
+func backRunes(text string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(text[:i])
+		i -= size
+	}
+	return i
+}
+
+// forwardRunes returns the byte offset n runes after i in text, or its end.
+func forwardRunes(text string, i, n int) int {
+	for ; n > 0 && i < len(text); n-- {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,140 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes one field that failed validation. Field is the JSON
+// name of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is returned when a payload breaks one or more rules.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("password", validatePassword)
+	v.RegisterValidation("year", validateYear)
+	return v
+}
+
+// Struct checks every rule declared in the validate tags of s, which must be
+// a pointer to a struct. It returns Errors if any rule fails.
+func Struct(s interface{}) error {
+	return translate(validate.Struct(s), s)
+}
+
+func translate(err error, s interface{}) error {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return err
+	}
+
+	t := reflect.Indirect(reflect.ValueOf(s)).Type()
+	errs := make(Errors, len(invalid))
+	for i, fe := range invalid {
+		errs[i] = FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: message(fe, t),
+		}
+	}
+	return errs
+}
+
+func message(fe validator.FieldError, t reflect.Type) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "required_without":
+		return fmt.Sprintf("%s is required without %s", fe.Field(), jsonName(t, fe.Param()))
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("%s must have at most %s items", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s characters long", fe.Field(), fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), fe.Param())
+	case "password":
+		return fmt.Sprintf("%s must be at least %d characters long and contain a letter and a digit", fe.Field(), minPasswordLength)
+	case "year":
+		return fmt.Sprintf("%s must be between %d and %d", fe.Field(), minYear, maxYear())
+	default:
+		return fmt.Sprintf("%s is invalid (%s)", fe.Field(), fe.Tag())
+	}
+}
+
+// jsonName returns the JSON name of the field of t called name, for the rules
+// whose parameter is another field.
+func jsonName(t reflect.Type, name string) string {
+	if field, ok := t.FieldByName(name); ok {
+		if tag := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]; tag != "" && tag != "-" {
+			return tag
+		}
+	}
+	return name
+}
+
+const (
+	minPasswordLength = 8
+	minYear           = 1
+)
+
+func validatePassword(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	if len(password) < minPasswordLength {
+		return false
+	}
+	var letter, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return letter && digit
+}
+
+// maxYear allows books announced for next year.
+func maxYear() int {
+	return time.Now().Year() + 1
+}
+
+func validateYear(fl validator.FieldLevel) bool {
+	year := int(fl.Field().Int())
+	return year >= minYear && year <= maxYear()
+}
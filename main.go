@@ -1,16 +1,77 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"users-books-api-testing/config"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/health"
+	"users-books-api-testing/lib/logging"
+	"users-books-api-testing/lib/metrics"
+	"users-books-api-testing/lib/search"
 	"users-books-api-testing/middlewares"
 	"users-books-api-testing/routes"
 )
 
 func main() {
-	config.InitDB()
-	e := routes.New()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	log := logging.Logger()
+	cfg := config.InitDB()
+	if err := config.DB.Use(metrics.GormPlugin{}); err != nil {
+		log.Fatal().Err(err).Msg("installing metrics")
+	}
+	migrator, err := config.Migrator()
+	if err != nil {
+		log.Fatal().Err(err).Msg("loading migrations")
+	}
+	store := database.NewGormStore(config.DB)
+	if err := store.IndexBooks(context.Background(), search.NewMemoryIndex(database.BookSearchWeights)); err != nil {
+		// most likely the migrations haven't run yet, which /readyz reports
+		log.Error().Err(err).Msg("indexing books; trying again on the first search")
+	}
+	e := routes.New(store, health.DB(config.DB), health.Migrations(migrator))
 
 	// logger middleware
 	middlewares.LogMiddlewares(e)
-	e.Logger.Fatal(e.Start(":8000"))
+
+	e.HideBanner = true
+	e.HidePort = true
+	e.Server.ReadTimeout = cfg.ReadTimeout
+	e.Server.WriteTimeout = cfg.WriteTimeout
+	e.Server.IdleTimeout = cfg.IdleTimeout
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.PurgeAfter > 0 {
+		go store.PurgeEvery(ctx, cfg.PurgeInterval, cfg.PurgeAfter)
+	}
+
+	go func() {
+		log.Info().Str("addr", cfg.Addr).Msg("http server started")
+		if err := e.Start(cfg.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("http server failed")
+		}
+	}()
+
+	<-ctx.Done()
+	// a second signal kills the process right away
+	stop()
+	log.Info().Msg("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("draining connections")
+	}
+	if err := config.CloseDB(); err != nil {
+		log.Error().Err(err).Msg("closing the database")
+	}
 }
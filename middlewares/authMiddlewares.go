@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Authorize must run after the JWT middleware. It only lets through tokens
+// whose role is one of roles.
+func Authorize(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !hasRole(c, roles) {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			}
+			return next(c)
+		}
+	}
+}
+
+// AuthorizeSelfOr is like Authorize, but also lets a user through when the
+// path parameter param is their own id.
+func AuthorizeSelfOr(param string, roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, err := strconv.Atoi(c.Param(param))
+			self := err == nil && id != 0 && id == ExtractTokenUserId(c)
+			if !self && !hasRole(c, roles) {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			}
+			return next(c)
+		}
+	}
+}
+
+func hasRole(c echo.Context, roles []string) bool {
+	role := ExtractTokenRole(c)
+	for _, r := range roles {
+		if role != "" && role == r {
+			return true
+		}
+	}
+	return false
+}
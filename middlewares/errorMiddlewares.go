@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"users-books-api-testing/lib/apierror"
+	"users-books-api-testing/lib/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorResponse is the body of every error the API returns.
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id"`
+}
+
+// ErrorHandler is the echo HTTPErrorHandler that renders errors returned by
+// handlers and middlewares as an ErrorResponse.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	logger := logging.FromContext(c.Request().Context())
+	apiErr := apierror.From(err)
+	switch {
+	case errors.Is(err, context.Canceled):
+		// the client went away, so nobody is waiting for the response
+		logger.Info().Err(err).Msg("request canceled")
+	case apiErr.Status >= http.StatusInternalServerError:
+		logger.Error().Err(err).Msg("request failed")
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiErr.Status)
+	} else {
+		err = c.JSON(apiErr.Status, ErrorResponse{
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			Details:   apiErr.Details,
+			RequestID: requestID(c),
+		})
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("writing error response")
+	}
+}
+
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
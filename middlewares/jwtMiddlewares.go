@@ -1,6 +1,11 @@
 package middlewares
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
 	"time"
 	"users-books-api-testing/config"
 
@@ -8,21 +13,108 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func CreateToken(userId int) (string, error) {
+func CreateToken(userId int, role string) (string, error) {
+	jti, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["userId"] = userId
+	claims["role"] = role
+	claims["jti"] = jti
 	claims["exp"] = time.Now().Add(time.Hour*1).Unix()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(config.SECRET_JWT))
 }
 
 func ExtractTokenUserId(e echo.Context) int {
-	user := e.Get("user").(*jwt.Token)
-	if user.Valid {
+	user, ok := e.Get("user").(*jwt.Token)
+	if ok && user.Valid {
 		claims := user.Claims.(jwt.MapClaims)
-		userId := claims["userId"].(int)
-		return userId
+		// numbers in JSON claims always decode as float64
+		userId, _ := claims["userId"].(float64)
+		return int(userId)
 	}
 	return 0
-}
\ No newline at end of file
+}
+
+func ExtractTokenRole(e echo.Context) string {
+	user, ok := e.Get("user").(*jwt.Token)
+	if ok && user.Valid {
+		claims := user.Claims.(jwt.MapClaims)
+		role, _ := claims["role"].(string)
+		return role
+	}
+	return ""
+}
+
+// ExtractTokenID returns the jti and expiry of the token the JWT middleware
+// stored on the request.
+func ExtractTokenID(e echo.Context) (string, time.Time) {
+	user, ok := e.Get("user").(*jwt.Token)
+	if !ok || !user.Valid {
+		return "", time.Time{}
+	}
+	return tokenID(user.Claims.(jwt.MapClaims))
+}
+
+// ParseTokenID verifies the signature of a token issued by CreateToken and
+// returns its jti and expiry. Expired tokens are reported with an error.
+func ParseTokenID(tokenString string) (string, time.Time, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.SECRET_JWT), nil
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	jti, exp := tokenID(token.Claims.(jwt.MapClaims))
+	return jti, exp, nil
+}
+
+// RevocationChecker is implemented by the token store that records logged
+// out and superseded access tokens.
+type RevocationChecker interface {
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RejectRevokedTokens must run after the JWT middleware. It turns away
+// tokens that were revoked before their exp, and tokens without a jti,
+// which cannot be revoked at all.
+func RejectRevokedTokens(checker RevocationChecker) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			jti, _ := ExtractTokenID(c)
+			if jti == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt")
+			}
+			revoked, err := checker.IsAccessTokenRevoked(c.Request().Context(), jti)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt")
+			}
+			return next(c)
+		}
+	}
+}
+
+func tokenID(claims jwt.MapClaims) (string, time.Time) {
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	return jti, time.Unix(int64(exp), 0)
+}
+
+// randomID returns 128 random bits, hex encoded.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,12 +1,45 @@
 package middlewares
 
 import (
+	"time"
+	"users-books-api-testing/lib/logging"
+
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 )
 
+// unlogged are the routes polled by the orchestrator, which would drown the
+// access log.
+var unlogged = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// LogMiddlewares writes one access log entry per request through the
+// request's logger, so it carries the request ID.
 func LogMiddlewares(e *echo.Echo) {
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: `[${time_rfc3339}] ${status} ${method} ${host}${path} ${latency_human}` + "\n",
-	}))
-}
\ No newline at end of file
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if unlogged[c.Path()] {
+				return next(c)
+			}
+
+			started := time.Now()
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			req, res := c.Request(), c.Response()
+			logging.FromContext(req.Context()).Info().
+				Str("method", req.Method).
+				Str("route", c.Path()).
+				Str("path", req.URL.Path).
+				Int("status", res.Status).
+				Int64("bytes", res.Size).
+				Str("remote_ip", c.RealIP()).
+				Dur("latency_ms", time.Since(started)).
+				Msg("request")
+			return nil
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"time"
+	"users-books-api-testing/lib/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+// unmatchedRoute labels requests that matched no route, so arbitrary paths
+// don't each get a series of their own.
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddlewares records every request in the HTTP metrics, labelled by
+// the route template it matched.
+func MetricsMiddlewares() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			started := time.Now()
+			err := next(c)
+			if err != nil {
+				// render the error now so its status is the one recorded
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = unmatchedRoute
+			}
+			metrics.ObserveRequest(c.Request().Method, route, c.Response().Status, time.Since(started))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"regexp"
+	"users-books-api-testing/lib/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+// validRequestID keeps IDs sent by clients and proxies from injecting
+// anything odd into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:+=/-]{1,128}$`)
+
+// RequestID tags the request with the X-Request-ID it came with, or a new one,
+// echoes it in the response and puts a logger carrying it in the request's
+// context.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID.MatchString(id) {
+				var err error
+				if id, err = randomID(); err != nil {
+					return err
+				}
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.SetRequest(req.WithContext(logging.WithRequestID(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
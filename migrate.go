@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"users-books-api-testing/config"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/migrate"
+)
+
+const migrateUsage = `usage: %s migrate <command>
+
+commands:
+  up             apply all pending migrations
+  down [steps]   roll back the last steps migrations (default 1)
+  status         list migrations and whether they are applied
+  create <name>  write empty up and down scripts for a new migration
+  promote <email>
+                 make the user with email an admin; signing up only makes
+                 members
+
+flags:
+`
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "migrations", "directory the create command writes new migrations to")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), migrateUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var err error
+	switch command := flags.Arg(0); command {
+	case "create":
+		err = migrateCreate(*dir, flags.Arg(1))
+	case "promote":
+		config.Connect()
+		err = migratePromote(database.NewGormStore(config.DB), flags.Arg(1))
+	case "up", "down", "status":
+		config.Connect()
+		var m *migrate.Migrator
+		if m, err = config.Migrator(); err != nil {
+			break
+		}
+		switch command {
+		case "up":
+			err = migrateUp(m)
+		case "down":
+			err = migrateDown(m, flags.Arg(1))
+		default:
+			err = migrateStatus(m)
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func migrateUp(m *migrate.Migrator) error {
+	applied, err := m.Up()
+	for _, migration := range applied {
+		fmt.Println("applied", migration)
+	}
+	if err == nil && len(applied) == 0 {
+		fmt.Println("no pending migrations")
+	}
+	return err
+}
+
+func migrateDown(m *migrate.Migrator, arg string) error {
+	steps := 1
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return fmt.Errorf("migrate down: steps must be a positive number, got %q", arg)
+		}
+		steps = n
+	}
+
+	rolledBack, err := m.Down(steps)
+	for _, migration := range rolledBack {
+		fmt.Println("rolled back", migration)
+	}
+	if err == nil && len(rolledBack) == 0 {
+		fmt.Println("no applied migrations")
+	}
+	return err
+}
+
+func migrateStatus(m *migrate.Migrator) error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-40s %s\n", status.Migration, applied)
+	}
+	return nil
+}
+
+func migrateCreate(dir, name string) error {
+	paths, err := migrate.Create(dir, name, config.Drivers())
+	for _, path := range paths {
+		fmt.Println("created", path)
+	}
+	return err
+}
+
+func migratePromote(store *database.Store, email string) error {
+	if email == "" {
+		return fmt.Errorf("migrate promote: the email of the user to promote is required")
+	}
+	user, err := store.PromoteUser(context.Background(), email)
+	if err != nil {
+		return fmt.Errorf("migrate promote %s: %w", email, err)
+	}
+	fmt.Printf("user %d (%s) is an admin\n", user.ID, user.Email)
+	return nil
+}
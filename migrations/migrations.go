@@ -0,0 +1,8 @@
+// Package migrations holds the versioned schema migrations, one directory
+// per database dialect. Create new ones with `go run . migrate create <name>`.
+package migrations
+
+import "embed"
+
+//go:embed sqlite mysql
+var FS embed.FS
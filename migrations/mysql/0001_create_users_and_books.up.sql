@@ -0,0 +1,30 @@
+-- IF NOT EXISTS adopts databases that were set up by AutoMigrate before
+-- migrations existed.
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `name` longtext,
+  `email` varchar(191),
+  `password` longtext,
+  `token` longtext,
+  `role` varchar(16) DEFAULT 'member',
+  PRIMARY KEY (`id`),
+  INDEX `idx_users_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `books` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `title` longtext,
+  `author` longtext,
+  `year` bigint,
+  `token` longtext,
+  `user_id` bigint unsigned,
+  PRIMARY KEY (`id`),
+  INDEX `idx_books_deleted_at` (`deleted_at`),
+  INDEX `idx_books_user_id` (`user_id`)
+);
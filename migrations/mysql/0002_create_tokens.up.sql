@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `user_id` bigint unsigned,
+  `token_hash` varchar(64),
+  `expires_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  `replaced_by_id` bigint unsigned,
+  PRIMARY KEY (`id`),
+  INDEX `idx_refresh_tokens_deleted_at` (`deleted_at`),
+  INDEX `idx_refresh_tokens_user_id` (`user_id`),
+  UNIQUE INDEX `idx_refresh_tokens_token_hash` (`token_hash`)
+);
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `jti` varchar(64) NOT NULL,
+  `expires_at` datetime(3) NULL,
+  PRIMARY KEY (`jti`),
+  INDEX `idx_revoked_tokens_expires_at` (`expires_at`)
+);
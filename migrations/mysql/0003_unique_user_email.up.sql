@@ -0,0 +1,4 @@
+-- emails used to be stored as typed, and in a column too wide to index
+UPDATE `users` SET `email` = LOWER(`email`);
+ALTER TABLE `users` MODIFY `email` varchar(191);
+CREATE UNIQUE INDEX `idx_users_email` ON `users` (`email`);
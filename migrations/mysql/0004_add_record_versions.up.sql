@@ -0,0 +1,4 @@
+-- version counts the writes to a record; updates name the version they read
+-- and fail if it has moved on since.
+ALTER TABLE `users` ADD COLUMN `version` bigint unsigned NOT NULL DEFAULT 1;
+ALTER TABLE `books` ADD COLUMN `version` bigint unsigned NOT NULL DEFAULT 1;
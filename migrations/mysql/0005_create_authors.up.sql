@@ -0,0 +1,35 @@
+CREATE TABLE `authors` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `name` varchar(255),
+  `version` bigint unsigned NOT NULL DEFAULT 1,
+  PRIMARY KEY (`id`),
+  INDEX `idx_authors_deleted_at` (`deleted_at`),
+  INDEX `idx_authors_name` (`name`)
+);
+
+CREATE TABLE `book_authors` (
+  `book_id` bigint unsigned NOT NULL,
+  `author_id` bigint unsigned NOT NULL,
+  `position` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`book_id`, `author_id`),
+  INDEX `idx_book_authors_author_id` (`author_id`)
+);
+
+-- Backfill: one author for each distinct byline, deleted books included, so
+-- that restoring a book finds its author. Bylines that name several people
+-- can't be told apart from one name and become one author, to be split by
+-- hand.
+INSERT INTO `authors` (`created_at`, `updated_at`, `name`)
+SELECT MIN(`created_at`), MIN(`created_at`), TRIM(`author`)
+FROM `books`
+WHERE TRIM(COALESCE(`author`, '')) <> ''
+GROUP BY TRIM(`author`)
+ORDER BY MIN(`id`);
+
+INSERT INTO `book_authors` (`book_id`, `author_id`, `position`)
+SELECT `books`.`id`, MIN(`authors`.`id`), 0
+FROM `books` JOIN `authors` ON `authors`.`name` = TRIM(`books`.`author`)
+GROUP BY `books`.`id`;
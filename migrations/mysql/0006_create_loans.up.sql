@@ -0,0 +1,17 @@
+-- copies is how many of a book there are to lend; every book so far is one.
+ALTER TABLE `books` ADD COLUMN `copies` bigint NOT NULL DEFAULT 1;
+
+-- A loan holds one copy of its book from checkout until returned_at is set.
+CREATE TABLE `loans` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `book_id` bigint unsigned NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `due_at` datetime(3) NOT NULL,
+  `returned_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_loans_book_id` (`book_id`),
+  INDEX `idx_loans_user_id` (`user_id`),
+  INDEX `idx_loans_due_at` (`due_at`)
+);
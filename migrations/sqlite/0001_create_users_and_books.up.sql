@@ -0,0 +1,28 @@
+-- IF NOT EXISTS adopts databases that were set up by AutoMigrate before
+-- migrations existed.
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `name` text,
+  `email` text,
+  `password` text,
+  `token` text,
+  `role` text DEFAULT 'member'
+);
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `books` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `title` text,
+  `author` text,
+  `year` integer,
+  `token` text,
+  `user_id` integer
+);
+CREATE INDEX IF NOT EXISTS `idx_books_deleted_at` ON `books` (`deleted_at`);
+CREATE INDEX IF NOT EXISTS `idx_books_user_id` ON `books` (`user_id`);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `user_id` integer,
+  `token_hash` varchar(64),
+  `expires_at` datetime,
+  `revoked_at` datetime,
+  `replaced_by_id` integer
+);
+CREATE INDEX IF NOT EXISTS `idx_refresh_tokens_deleted_at` ON `refresh_tokens` (`deleted_at`);
+CREATE INDEX IF NOT EXISTS `idx_refresh_tokens_user_id` ON `refresh_tokens` (`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_refresh_tokens_token_hash` ON `refresh_tokens` (`token_hash`);
+
+CREATE TABLE IF NOT EXISTS `revoked_tokens` (
+  `jti` varchar(64),
+  `expires_at` datetime,
+  PRIMARY KEY (`jti`)
+);
+CREATE INDEX IF NOT EXISTS `idx_revoked_tokens_expires_at` ON `revoked_tokens` (`expires_at`);
@@ -0,0 +1,3 @@
+-- emails used to be stored as typed
+UPDATE `users` SET `email` = LOWER(`email`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_email` ON `users` (`email`);
@@ -0,0 +1,34 @@
+-- SQLite before 3.35 can't drop columns, so the tables are rebuilt without it.
+CREATE TABLE `users__old` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `name` text,
+  `email` text,
+  `password` text,
+  `token` text,
+  `role` text DEFAULT 'member'
+);
+INSERT INTO `users__old` SELECT `id`, `created_at`, `updated_at`, `deleted_at`, `name`, `email`, `password`, `token`, `role` FROM `users`;
+DROP TABLE `users`;
+ALTER TABLE `users__old` RENAME TO `users`;
+CREATE INDEX `idx_users_deleted_at` ON `users` (`deleted_at`);
+CREATE UNIQUE INDEX `idx_users_email` ON `users` (`email`);
+
+CREATE TABLE `books__old` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `title` text,
+  `author` text,
+  `year` integer,
+  `token` text,
+  `user_id` integer
+);
+INSERT INTO `books__old` SELECT `id`, `created_at`, `updated_at`, `deleted_at`, `title`, `author`, `year`, `token`, `user_id` FROM `books`;
+DROP TABLE `books`;
+ALTER TABLE `books__old` RENAME TO `books`;
+CREATE INDEX `idx_books_deleted_at` ON `books` (`deleted_at`);
+CREATE INDEX `idx_books_user_id` ON `books` (`user_id`);
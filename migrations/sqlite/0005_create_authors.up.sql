@@ -0,0 +1,33 @@
+CREATE TABLE `authors` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `name` text,
+  `version` integer NOT NULL DEFAULT 1
+);
+CREATE INDEX `idx_authors_deleted_at` ON `authors` (`deleted_at`);
+CREATE INDEX `idx_authors_name` ON `authors` (`name`);
+
+CREATE TABLE `book_authors` (
+  `book_id` integer NOT NULL,
+  `author_id` integer NOT NULL,
+  `position` integer NOT NULL DEFAULT 0,
+  PRIMARY KEY (`book_id`, `author_id`)
+);
+CREATE INDEX `idx_book_authors_author_id` ON `book_authors` (`author_id`);
+
+-- Backfill: one author for each distinct byline, deleted books included, so
+-- that restoring a book finds its author. Bylines that name several people
+-- can't be told apart from one name and become one author, to be split by
+-- hand.
+INSERT INTO `authors` (`created_at`, `updated_at`, `name`)
+SELECT MIN(`created_at`), MIN(`created_at`), TRIM(`author`)
+FROM `books`
+WHERE TRIM(COALESCE(`author`, '')) <> ''
+GROUP BY TRIM(`author`)
+ORDER BY MIN(`id`);
+
+INSERT INTO `book_authors` (`book_id`, `author_id`, `position`)
+SELECT `books`.`id`, `authors`.`id`, 0
+FROM `books` JOIN `authors` ON `authors`.`name` = TRIM(`books`.`author`);
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS `loans`;
+
+-- SQLite before 3.35 can't drop columns, so books is rebuilt without copies.
+CREATE TABLE `books__old` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `title` text,
+  `author` text,
+  `year` integer,
+  `token` text,
+  `user_id` integer,
+  `version` integer NOT NULL DEFAULT 1
+);
+INSERT INTO `books__old` SELECT `id`, `created_at`, `updated_at`, `deleted_at`, `title`, `author`, `year`, `token`, `user_id`, `version` FROM `books`;
+DROP TABLE `books`;
+ALTER TABLE `books__old` RENAME TO `books`;
+CREATE INDEX `idx_books_deleted_at` ON `books` (`deleted_at`);
+CREATE INDEX `idx_books_user_id` ON `books` (`user_id`);
@@ -0,0 +1,16 @@
+-- copies is how many of a book there are to lend; every book so far is one.
+ALTER TABLE `books` ADD COLUMN `copies` integer NOT NULL DEFAULT 1;
+
+-- A loan holds one copy of its book from checkout until returned_at is set.
+CREATE TABLE `loans` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `book_id` integer NOT NULL,
+  `user_id` integer NOT NULL,
+  `due_at` datetime NOT NULL,
+  `returned_at` datetime
+);
+CREATE INDEX `idx_loans_book_id` ON `loans` (`book_id`);
+CREATE INDEX `idx_loans_user_id` ON `loans` (`user_id`);
+CREATE INDEX `idx_loans_due_at` ON `loans` (`due_at`);
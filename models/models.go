@@ -1,19 +1,109 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// The models are what is stored. Handlers never serialize them; clients
+// get the types in package dto instead.
 
 type Users struct {
 	gorm.Model
-	Name     string `json:"name" form:"name"`
-	Email    string `json:"email" form:"email"`
-	Password string `json:"password" form:"password"`
-	Token    string `json:"token" form:"token"`
+	Name string `json:"name" form:"name"`
+	// Email is stored in lower case and is unique, soft-deleted accounts
+	// included.
+	Email string `json:"email" form:"email" gorm:"size:191;uniqueIndex"`
+	// Password is only ever read from requests; it is hashed into
+	// PasswordHash before anything is stored and is never persisted.
+	Password     string `json:"password,omitempty" form:"password" gorm:"-"`
+	PasswordHash string `json:"-" form:"-" gorm:"column:password"`
+	Token        string `json:"token" form:"token"`
+	// Role is RoleAdmin or RoleMember; it is embedded in the user's tokens.
+	Role string `json:"role" form:"role" gorm:"size:16;default:member"`
+	// Version goes up by one with every update; see Books.Version.
+	Version uint `json:"version" form:"-" gorm:"not null;default:1"`
 }
 
 type Books struct {
 	gorm.Model
-	Title  string `json:"title" form:"title"`
+	Title string `json:"title" form:"title"`
+	// Author is the byline: the names of the book's authors, as linked in
+	// book_authors, joined with commas. It is kept in step with them.
 	Author string `json:"author" form:"author"`
 	Year   int    `json:"year" form:"year"`
 	Token  string `json:"token" form:"token"`
+	// UserID is the owner, taken from the token of the user who added the
+	// book. Books added before ownership existed have none.
+	UserID uint   `json:"user_id" form:"-" gorm:"index"`
+	User   *Users `json:"-" form:"-"`
+	// Version goes up by one with every update. Updates carry the version
+	// they were based on and fail if the book has moved on since, so
+	// concurrent writers can't overwrite each other unknowingly.
+	Version uint `json:"version" form:"-" gorm:"not null;default:1"`
+	// Copies is how many of the book there are to lend. Loans that aren't
+	// returned each hold one.
+	Copies int `json:"copies" form:"copies" gorm:"not null;default:1"`
+	// AuthorIDs, when not nil, is who the book is by, in byline order, for
+	// the book repository to link it to. It isn't read back.
+	AuthorIDs []uint `json:"-" form:"-" gorm:"-"`
+}
+
+// Authors are the people books are by. A book can have several, and the
+// same author many books, through BookAuthors.
+type Authors struct {
+	gorm.Model
+	Name string `json:"name" form:"name" gorm:"size:255;index"`
+	// Version goes up by one with every update; see Books.Version.
+	Version uint `json:"version" form:"-" gorm:"not null;default:1"`
+}
+
+// BookAuthors links books to their authors. Position orders the authors of
+// a book as they appear in its byline.
+type BookAuthors struct {
+	BookID   uint `gorm:"primaryKey"`
+	AuthorID uint `gorm:"primaryKey;index"`
+	Position int  `gorm:"not null;default:0"`
+}
+
+// Loans lend a copy of a book to a user from checkout until the book is
+// returned. They are kept after that as the user's history.
+type Loans struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	BookID    uint      `json:"book_id" gorm:"not null;index"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	DueAt     time.Time `json:"due_at" gorm:"not null;index"`
+	// ReturnedAt is nil while the copy is out.
+	ReturnedAt *time.Time `json:"returned_at"`
+}
+
+// Overdue reports whether the loan is still out past its due date at now.
+func (l Loans) Overdue(now time.Time) bool {
+	return l.ReturnedAt == nil && now.After(l.DueAt)
+}
+
+// RefreshTokens are opaque, single-use tokens exchanged at /refresh for a
+// new access token. Only a SHA-256 hash of the token is stored.
+type RefreshTokens struct {
+	gorm.Model
+	UserID       uint       `json:"user_id" gorm:"index"`
+	TokenHash    string     `json:"-" gorm:"size:64;uniqueIndex"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"`
+}
+
+// RevokedTokens is the denylist of access tokens (by jti) that were logged
+// out or superseded before they expired.
+type RevokedTokens struct {
+	JTI       string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"index"`
 }
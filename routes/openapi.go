@@ -0,0 +1,379 @@
+package routes
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+	"users-books-api-testing/dto"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/mergepatch"
+	"users-books-api-testing/lib/openapi"
+	"users-books-api-testing/lib/validation"
+	"users-books-api-testing/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed swagger-ui.html
+var swaggerUI string
+
+// registerDocs serves the OpenAPI document and a Swagger UI page for it.
+func registerDocs(e *echo.Echo) {
+	spec := Spec()
+	e.GET("/openapi.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, spec)
+	})
+	e.GET("/docs", func(c echo.Context) error {
+		return c.HTML(http.StatusOK, swaggerUI)
+	})
+}
+
+// operation documents one route registered in New.
+type operation struct {
+	method, path string
+	tag, summary string
+	// auth marks routes in the /jwt group
+	auth   bool
+	params []openapi.Parameter
+	body   *openapi.Schema
+	// bodyType is the content type of body, JSON unless set
+	bodyType string
+	ok       *openapi.Schema
+	// okType is the content type of ok, JSON unless set
+	okType string
+	// etag marks responses that carry the ETag of the record in ok
+	etag bool
+	// errors are the statuses, besides 500, the route can fail with
+	errors []int
+}
+
+var errorResponses = map[int]struct{ name, description string }{
+	http.StatusBadRequest:           {"BadRequest", "The request is malformed."},
+	http.StatusUnauthorized:         {"Unauthorized", "The credentials or token are missing, invalid or revoked."},
+	http.StatusForbidden:            {"Forbidden", "The token's user may not do this."},
+	http.StatusNotFound:             {"NotFound", "The record does not exist."},
+	http.StatusConflict:             {"Conflict", "The change conflicts with an existing record."},
+	http.StatusPreconditionFailed:   {"PreconditionFailed", "The record changed since the version in If-Match, or while it was being written; fetch it again."},
+	http.StatusUnsupportedMediaType: {"UnsupportedMediaType", "The body has the wrong content type."},
+	http.StatusUnprocessableEntity:  {"ValidationFailed", "The payload breaks validation rules, listed in details."},
+	http.StatusTooManyRequests:      {"TooManyRequests", "Too many attempts; retry after the number of seconds in Retry-After."},
+	http.StatusInternalServerError:  {"InternalError", "Something went wrong on the server."},
+	http.StatusServiceUnavailable:   {"Unavailable", "The service can't take traffic yet, or the database didn't answer in time."},
+}
+
+// Spec describes every route registered in New.
+func Spec() *openapi.Document {
+	spec := openapi.New(openapi.Info{
+		Title:       "Users and Books API",
+		Description: "Users, their books and the books' authors, the loans of books to users, and the tokens that authenticate them.",
+		Version:     "1.0.0",
+	})
+
+	spec.Components.Schemas["User"] = openapi.SchemaOf(dto.User{})
+	spec.Components.Schemas["Book"] = openapi.SchemaOf(dto.Book{})
+	spec.Components.Schemas["Book"].Properties["authors"] = &openapi.Schema{
+		Description: "Only with ?expand=authors, in byline order.",
+		Items:       openapi.Ref("Author"),
+		Type:        "array",
+	}
+	spec.Components.Schemas["Author"] = openapi.SchemaOf(dto.Author{})
+	spec.Components.Schemas["CreateUserRequest"] = openapi.SchemaOf(dto.CreateUserRequest{})
+	spec.Components.Schemas["UpdateUserRequest"] = openapi.SchemaOf(dto.UpdateUserRequest{})
+	spec.Components.Schemas["PatchUserRequest"] = openapi.SchemaOf(dto.PatchUserRequest{})
+	spec.Components.Schemas["LoginRequest"] = openapi.SchemaOf(dto.LoginRequest{})
+	spec.Components.Schemas["CreateBookRequest"] = openapi.SchemaOf(dto.CreateBookRequest{})
+	spec.Components.Schemas["UpdateBookRequest"] = openapi.SchemaOf(dto.UpdateBookRequest{})
+	spec.Components.Schemas["PatchBookRequest"] = openapi.SchemaOf(dto.PatchBookRequest{})
+	spec.Components.Schemas["CreateAuthorRequest"] = openapi.SchemaOf(dto.CreateAuthorRequest{})
+	spec.Components.Schemas["UpdateAuthorRequest"] = openapi.SchemaOf(dto.UpdateAuthorRequest{})
+	spec.Components.Schemas["Loan"] = openapi.SchemaOf(dto.Loan{})
+	spec.Components.Schemas["CreateLoanRequest"] = openapi.SchemaOf(dto.CreateLoanRequest{})
+	spec.Components.Schemas["BookSearchResult"] = openapi.SchemaOf(dto.BookSearchResult{})
+	spec.Components.Schemas["BookSearchResult"].Properties["book"] = openapi.Ref("Book")
+	spec.Components.Schemas["Error"] = openapi.SchemaOf(middlewares.ErrorResponse{})
+	spec.Components.Schemas["Error"].Properties["details"] = &openapi.Schema{
+		Description: "For validation_failed, the fields that failed.",
+		Items:       openapi.SchemaOf(validation.FieldError{}),
+		Type:        "array",
+	}
+	spec.Components.Schemas["Page"] = openapi.Object(map[string]*openapi.Schema{
+		"total":       openapi.Type("integer"),
+		"limit":       openapi.Type("integer"),
+		"offset":      {Type: "integer", Description: "Only when paging by offset."},
+		"next_cursor": openapi.Type("string"),
+		"next":        {Type: "string", Nullable: true, Description: "Link to the next page, null on the last one."},
+	})
+	spec.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	}
+	for _, response := range errorResponses {
+		spec.Components.Responses[response.name] = &openapi.Response{
+			Description: response.description,
+			Content:     openapi.JSON(openapi.Ref("Error")),
+		}
+	}
+	spec.Components.Responses["TooManyRequests"].Headers = map[string]*openapi.Header{
+		"Retry-After": {Description: "Seconds to wait before trying again.", Schema: openapi.Type("integer")},
+	}
+
+	for _, op := range operations() {
+		spec.Add(op.method, op.path, op.build())
+	}
+	return spec
+}
+
+func (op operation) build() *openapi.Operation {
+	o := &openapi.Operation{
+		Tags:       []string{op.tag},
+		Summary:    op.summary,
+		Parameters: op.params,
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OK", Content: openapi.JSON(op.ok)},
+		},
+	}
+	if op.okType != "" {
+		o.Responses["200"].Content = map[string]openapi.MediaType{op.okType: {Schema: op.ok}}
+	}
+	if op.etag {
+		o.Responses["200"].Headers = map[string]*openapi.Header{
+			"ETag": {Description: "Version of the record, for If-Match.", Schema: openapi.Type("string")},
+		}
+	}
+	if op.body != nil {
+		o.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSON(op.body)}
+	}
+	if op.bodyType != "" {
+		o.RequestBody.Content = map[string]openapi.MediaType{op.bodyType: {Schema: op.body}}
+	}
+	errors := op.errors
+	if op.auth {
+		// the JWT middleware answers 400 without a token and 401 with a bad
+		// one, and every route behind it goes to the database
+		errors = append(errors, http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable)
+		o.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}}
+	}
+	for _, status := range append(errors, http.StatusInternalServerError) {
+		o.Responses[strconv.Itoa(status)] = openapi.ResponseRef(errorResponses[status].name)
+	}
+	return o
+}
+
+func operations() []operation {
+	user := openapi.Ref("User")
+	book := openapi.Ref("Book")
+	refreshToken := openapi.Object(map[string]*openapi.Schema{
+		"refresh_token": openapi.Type("string"),
+	})
+	session := message(map[string]*openapi.Schema{
+		"user":          user,
+		"access_token":  {Type: "string", Description: "JWT for the Authorization header of /jwt routes"},
+		"refresh_token": openapi.Type("string"),
+	})
+	userPage := message(map[string]*openapi.Schema{"users": openapi.ArrayOf(user), "page": openapi.Ref("Page")})
+	readiness := openapi.Object(map[string]*openapi.Schema{
+		"status":         {Type: "string", Enum: []interface{}{"ready", "unavailable"}},
+		"checks":         {Type: "object", AdditionalProperties: openapi.Type("string"), Description: "\"ok\" or why the check failed, by check name"},
+		"version":        openapi.Type("string"),
+		"uptime_seconds": openapi.Type("integer"),
+	})
+	bookPage := message(map[string]*openapi.Schema{"books": openapi.ArrayOf(book), "page": openapi.Ref("Page")})
+	author := openapi.Ref("Author")
+	authorPage := message(map[string]*openapi.Schema{"authors": openapi.ArrayOf(author), "page": openapi.Ref("Page")})
+	loan := openapi.Ref("Loan")
+	loanPage := message(map[string]*openapi.Schema{"loans": openapi.ArrayOf(loan), "page": openapi.Ref("Page")})
+
+	return []operation{
+		{method: http.MethodPost, path: "/login", tag: "auth", summary: "Log in with email and password",
+			body: openapi.Ref("LoginRequest"), ok: session,
+			errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusServiceUnavailable}},
+		{method: http.MethodPost, path: "/refresh", tag: "auth", summary: "Exchange a refresh token for new tokens",
+			body: refreshToken, ok: session,
+			errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable}},
+		{method: http.MethodPost, path: "/jwt/logout", tag: "auth", auth: true,
+			summary: "Revoke the access token, and the given refresh token or all of the user's",
+			body:    refreshToken, ok: message(nil)},
+
+		{method: http.MethodPost, path: "/users", tag: "users", summary: "Sign up",
+			body: openapi.Ref("CreateUserRequest"), ok: message(map[string]*openapi.Schema{"user": user}),
+			errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusServiceUnavailable}},
+		{method: http.MethodGet, path: "/jwt/users", tag: "users", auth: true, summary: "List users (admin)",
+			params: append(listParams(), query("name", "string", "Name contains"), query("role", "string", "Role is"), includeDeletedParam()),
+			ok:     userPage, errors: []int{http.StatusForbidden}},
+		{method: http.MethodGet, path: "/jwt/users/:id", tag: "users", auth: true, summary: "Get a user (self or admin)",
+			params: idParam(), ok: message(map[string]*openapi.Schema{"user": user}), etag: true,
+			errors: []int{http.StatusForbidden, http.StatusNotFound}},
+		{method: http.MethodPut, path: "/jwt/users/:id", tag: "users", auth: true,
+			summary: "Update a user (self or admin; only admins change roles)",
+			params:  updateParams(), body: openapi.Ref("UpdateUserRequest"), ok: message(map[string]*openapi.Schema{"user": user}), etag: true,
+			errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnprocessableEntity}},
+		{method: http.MethodPatch, path: "/jwt/users/:id", tag: "users", auth: true,
+			summary: "Update a user with a JSON Merge Patch (self or admin; only admins change roles)",
+			params:  updateParams(), body: openapi.Ref("PatchUserRequest"), bodyType: mergepatch.ContentType,
+			ok: message(map[string]*openapi.Schema{"user": user}), etag: true,
+			errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed,
+				http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity}},
+		{method: http.MethodDelete, path: "/jwt/users/:id", tag: "users", auth: true, summary: "Delete a user (self or admin)",
+			params: idParam(), ok: message(nil), errors: []int{http.StatusForbidden, http.StatusNotFound}},
+		{method: http.MethodPost, path: "/jwt/users/:id/restore", tag: "users", auth: true,
+			summary: "Restore a deleted user (admin)",
+			params:  idParam(), ok: message(map[string]*openapi.Schema{"user": user}),
+			errors: []int{http.StatusForbidden, http.StatusNotFound}},
+		{method: http.MethodPost, path: "/jwt/users/:id/unlock", tag: "users", auth: true,
+			summary: "Lift a login lockout on a user's account (admin)",
+			params:  idParam(), ok: message(nil), errors: []int{http.StatusForbidden, http.StatusNotFound}},
+		{method: http.MethodGet, path: "/jwt/users/:id/loans", tag: "loans", auth: true,
+			summary: "List a user's loans, returned ones included (self or admin)",
+			params:  append(append(idParam(), listParams()...), loanStatusParam()),
+			ok:      loanPage, errors: []int{http.StatusForbidden, http.StatusNotFound}},
+		{method: http.MethodGet, path: "/jwt/users/:id/books", tag: "books", auth: true, summary: "List a user's books",
+			params: append(idParam(), expandParam()), ok: message(map[string]*openapi.Schema{"books": openapi.ArrayOf(book)}),
+			errors: []int{http.StatusNotFound}},
+
+		{method: http.MethodPost, path: "/jwt/books", tag: "books", auth: true, summary: "Add a book owned by the token's user",
+			params: []openapi.Parameter{expandParam()},
+			body:   openapi.Ref("CreateBookRequest"), ok: message(map[string]*openapi.Schema{"book": book}),
+			errors: []int{http.StatusUnprocessableEntity}},
+		{method: http.MethodGet, path: "/jwt/books", tag: "books", auth: true, summary: "List books",
+			params: append(listParams(),
+				query("author", "string", "Byline is, in any case"),
+				query("author_id", "integer", "By the author with this id"),
+				query("title", "string", "Title contains"),
+				query("year_from", "integer", "Published in or after"),
+				query("year_to", "integer", "Published in or before"),
+				includeDeletedParam(), expandParam()),
+			ok: bookPage, errors: []int{http.StatusForbidden}},
+		{method: http.MethodGet, path: "/jwt/books/search", tag: "books", auth: true,
+			summary: "Search books by the words of their title and author, best match first",
+			params: []openapi.Parameter{
+				{Name: "q", In: "query", Required: true, Schema: openapi.Type("string"),
+					Description: "Words that must all match; a word also matches words it begins, and longer words a typo away"},
+				query("limit", "integer", "Page size, 20 by default and 100 at most"),
+				query("offset", "integer", "Results to skip"),
+				expandParam(),
+			},
+			ok: message(map[string]*openapi.Schema{
+				"results": openapi.ArrayOf(openapi.Ref("BookSearchResult")),
+				"total":   openapi.Type("integer"),
+			})},
+		{method: http.MethodGet, path: "/jwt/books/:id", tag: "books", auth: true, summary: "Get a book",
+			params: append(idParam(), expandParam()), ok: message(map[string]*openapi.Schema{"book": book}), etag: true,
+			errors: []int{http.StatusNotFound}},
+		{method: http.MethodPut, path: "/jwt/books/:id", tag: "books", auth: true, summary: "Update a book (owner or admin)",
+			params: append(updateParams(), expandParam()), body: openapi.Ref("UpdateBookRequest"), ok: message(map[string]*openapi.Schema{"book": book}), etag: true,
+			errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusUnprocessableEntity}},
+		{method: http.MethodPatch, path: "/jwt/books/:id", tag: "books", auth: true,
+			summary: "Update a book with a JSON Merge Patch (owner or admin)",
+			params:  append(updateParams(), expandParam()), body: openapi.Ref("PatchBookRequest"), bodyType: mergepatch.ContentType,
+			ok: message(map[string]*openapi.Schema{"book": book}), etag: true,
+			errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed,
+				http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity}},
+		{method: http.MethodDelete, path: "/jwt/books/:id", tag: "books", auth: true,
+			summary: "Delete a book with no copies lent out (owner or admin)",
+			params:  idParam(), ok: message(nil), errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}},
+		{method: http.MethodPost, path: "/jwt/books/:id/restore", tag: "books", auth: true,
+			summary: "Restore a deleted book (admin)",
+			params:  append(idParam(), expandParam()), ok: message(map[string]*openapi.Schema{"book": book}),
+			errors: []int{http.StatusForbidden, http.StatusNotFound}},
+
+		{method: http.MethodPost, path: "/jwt/authors", tag: "authors", auth: true, summary: "Add an author",
+			body: openapi.Ref("CreateAuthorRequest"), ok: message(map[string]*openapi.Schema{"author": author}),
+			errors: []int{http.StatusUnprocessableEntity}},
+		{method: http.MethodGet, path: "/jwt/authors", tag: "authors", auth: true, summary: "List authors",
+			params: append(listParams(), query("name", "string", "Name contains")), ok: authorPage},
+		{method: http.MethodGet, path: "/jwt/authors/:id", tag: "authors", auth: true, summary: "Get an author",
+			params: idParam(), ok: message(map[string]*openapi.Schema{"author": author}), etag: true,
+			errors: []int{http.StatusNotFound}},
+		{method: http.MethodPut, path: "/jwt/authors/:id", tag: "authors", auth: true,
+			summary: "Rename an author, and the bylines of their books with them (admin)",
+			params:  updateParams(), body: openapi.Ref("UpdateAuthorRequest"), ok: message(map[string]*openapi.Schema{"author": author}), etag: true,
+			errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusUnprocessableEntity}},
+		{method: http.MethodDelete, path: "/jwt/authors/:id", tag: "authors", auth: true,
+			summary: "Delete an author who has no books (admin)",
+			params:  idParam(), ok: message(nil), errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}},
+
+		{method: http.MethodPost, path: "/jwt/loans", tag: "loans", auth: true,
+			summary: "Check out a copy of a book, for the token's user or, by an admin, for anyone",
+			body:    openapi.Ref("CreateLoanRequest"), ok: message(map[string]*openapi.Schema{"loan": loan}),
+			errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}},
+		{method: http.MethodGet, path: "/jwt/loans", tag: "loans", auth: true, summary: "List loans (admin)",
+			params: append(listParams(),
+				query("user_id", "integer", "Borrowed by the user with this id"),
+				query("book_id", "integer", "Of the book with this id"),
+				loanStatusParam()),
+			ok: loanPage, errors: []int{http.StatusForbidden}},
+		{method: http.MethodGet, path: "/jwt/loans/overdue", tag: "loans", auth: true,
+			summary: "List the loans past their due date, by due date unless sorted otherwise (admin)",
+			params:  listParams(), ok: loanPage, errors: []int{http.StatusForbidden}},
+		{method: http.MethodGet, path: "/jwt/loans/:id", tag: "loans", auth: true, summary: "Get a loan (borrower or admin)",
+			params: idParam(), ok: message(map[string]*openapi.Schema{"loan": loan}),
+			errors: []int{http.StatusForbidden, http.StatusNotFound}},
+		{method: http.MethodPost, path: "/jwt/loans/:id/return", tag: "loans", auth: true,
+			summary: "Return the copy of a loan (borrower or admin)",
+			params:  idParam(), ok: message(map[string]*openapi.Schema{"loan": loan}),
+			errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict}},
+
+		{method: http.MethodGet, path: "/healthz", tag: "probes", summary: "Liveness: the process is up",
+			ok: openapi.Object(map[string]*openapi.Schema{"status": openapi.Type("string")})},
+		{method: http.MethodGet, path: "/readyz", tag: "probes",
+			summary: "Readiness: the database answers and the schema is up to date",
+			ok:      readiness, errors: []int{http.StatusServiceUnavailable}},
+
+		{method: http.MethodGet, path: "/metrics", tag: "probes", summary: "Prometheus metrics",
+			ok: openapi.Type("string"), okType: "text/plain; version=0.0.4"},
+
+		{method: http.MethodGet, path: "/openapi.json", tag: "docs", summary: "This document",
+			ok: openapi.Type("object")},
+		{method: http.MethodGet, path: "/docs", tag: "docs", summary: "Swagger UI for this document",
+			ok: openapi.Type("string"), okType: echo.MIMETextHTMLCharsetUTF8},
+	}
+}
+
+// message is the body of a successful response: a message plus properties.
+func message(properties map[string]*openapi.Schema) *openapi.Schema {
+	schema := openapi.Object(map[string]*openapi.Schema{"message": openapi.Type("string")})
+	for name, property := range properties {
+		schema.Properties[name] = property
+	}
+	return schema
+}
+
+func idParam() []openapi.Parameter {
+	return []openapi.Parameter{{Name: "id", In: "path", Required: true, Schema: openapi.Type("integer")}}
+}
+
+// updateParams are those of the routes that update a record.
+func updateParams() []openapi.Parameter {
+	return append(idParam(), openapi.Parameter{
+		Name: "If-Match", In: "header", Schema: openapi.Type("string"),
+		Description: "ETag the record must still have for the update to go ahead",
+	})
+}
+
+func query(name, typ, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: openapi.Type(typ)}
+}
+
+func includeDeletedParam() openapi.Parameter {
+	return query("include_deleted", "boolean", "Include soft-deleted records (admin only)")
+}
+
+func expandParam() openapi.Parameter {
+	return openapi.Parameter{Name: "expand", In: "query", Description: "authors, to embed the authors of the books",
+		Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"authors"}}}
+}
+
+func loanStatusParam() openapi.Parameter {
+	return openapi.Parameter{Name: "status", In: "query", Description: "Only the loans that are out, back, or out past their due date",
+		Schema: &openapi.Schema{Type: "string", Enum: []interface{}{database.LoanActive, database.LoanReturned, database.LoanOverdue}}}
+}
+
+func listParams() []openapi.Parameter {
+	return []openapi.Parameter{
+		query("limit", "integer", "Page size, 20 by default and 100 at most"),
+		query("offset", "integer", "Records to skip"),
+		query("cursor", "string", "next_cursor of the previous page, instead of offset"),
+		query("sort", "string", "Column to sort by, prefixed with - for descending"),
+	}
+}
@@ -3,31 +3,83 @@ package routes
 import (
 	"users-books-api-testing/config"
 	"users-books-api-testing/controllers"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/health"
+	"users-books-api-testing/lib/metrics"
+	"users-books-api-testing/middlewares"
+	"users-books-api-testing/models"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func New() *echo.Echo {
+// New builds the router on top of store. checks are what /readyz reports
+// on.
+func New(store *database.Store, checks ...health.Check) *echo.Echo {
 	e := echo.New()
+	e.HTTPErrorHandler = middlewares.ErrorHandler
+	// login limits are per client IP, so the IP must not be up to the client
+	e.IPExtractor = echo.ExtractIPDirect()
+	if config.TRUST_PROXY_HEADERS {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	}
+	e.Use(middlewares.RequestID())
+	e.Use(middlewares.MetricsMiddlewares())
+	e.Use(middlewares.Timeout(config.DB_TIMEOUT))
+	ctl := controllers.New(store)
+	registerDocs(e)
+	e.GET("/metrics", metrics.Handler())
 
-	e.POST("/login", controllers.LoginUserController)
+	probes := controllers.NewHealth(checks...)
+	e.GET("/healthz", probes.LivenessController)
+	e.GET("/readyz", probes.ReadinessController)
 
-	e.POST("/users", controllers.CreateUserController)
+	e.POST("/login", ctl.LoginUserController)
+	e.POST("/refresh", ctl.RefreshTokenController)
+
+	e.POST("/users", ctl.CreateUserController)
 
 	// JWT Auth Group
 	eJWT := e.Group("/jwt")
 	eJWT.Use(middleware.JWT([]byte(config.SECRET_JWT)))
-	eJWT.GET("/users", controllers.GetUsersController)
-	eJWT.GET("/users/:id", controllers.GetUserByIdController)
-	eJWT.PUT("/users/:id", controllers.UpdateUserByIdController)
-	eJWT.DELETE("/users/:id", controllers.DeleteUserByIdController)
-
-	e.POST("/books", controllers.AddBookController) //
-	eJWT.GET("/books", controllers.GetBooksController)
-	eJWT.GET("/books/:id", controllers.GetBookByIdController)
-	eJWT.PUT("/books/:id", controllers.UpdateBookByIdController)    //
-	eJWT.DELETE("/books/:id", controllers.DeleteBookByIdController) //
+	eJWT.Use(middlewares.RejectRevokedTokens(store.Tokens))
+	eJWT.POST("/logout", ctl.LogoutController)
+	admin := middlewares.Authorize(models.RoleAdmin)
+	selfOrAdmin := middlewares.AuthorizeSelfOr("id", models.RoleAdmin)
+
+	eJWT.GET("/users", ctl.GetUsersController, admin)
+	eJWT.GET("/users/:id", ctl.GetUserByIdController, selfOrAdmin)
+	eJWT.PUT("/users/:id", ctl.UpdateUserByIdController, selfOrAdmin)
+	eJWT.PATCH("/users/:id", ctl.PatchUserByIdController, selfOrAdmin)
+	eJWT.DELETE("/users/:id", ctl.DeleteUserByIdController, selfOrAdmin)
+	eJWT.POST("/users/:id/restore", ctl.RestoreUserController, admin)
+	eJWT.POST("/users/:id/unlock", ctl.UnlockUserController, admin)
+	eJWT.GET("/users/:id/books", ctl.GetUserBooksController)
+	eJWT.GET("/users/:id/loans", ctl.GetUserLoansController, selfOrAdmin)
+
+	eJWT.POST("/books", ctl.AddBookController)
+	eJWT.GET("/books", ctl.GetBooksController)
+	eJWT.GET("/books/search", ctl.SearchBooksController)
+	eJWT.GET("/books/:id", ctl.GetBookByIdController)
+	eJWT.PUT("/books/:id", ctl.UpdateBookByIdController)
+	eJWT.PATCH("/books/:id", ctl.PatchBookByIdController)
+	eJWT.DELETE("/books/:id", ctl.DeleteBookByIdController)
+	eJWT.POST("/books/:id/restore", ctl.RestoreBookController, admin)
+
+	// renaming an author rewrites the bylines of books other users own
+	eJWT.POST("/authors", ctl.CreateAuthorController)
+	eJWT.GET("/authors", ctl.GetAuthorsController)
+	eJWT.GET("/authors/:id", ctl.GetAuthorByIdController)
+	eJWT.PUT("/authors/:id", ctl.UpdateAuthorByIdController, admin)
+	eJWT.DELETE("/authors/:id", ctl.DeleteAuthorByIdController, admin)
+
+	// members borrow and return for themselves and see their loans through
+	// /users/:id/loans; the listings of everyone's loans are for admins
+	eJWT.POST("/loans", ctl.CheckOutBookController)
+	eJWT.GET("/loans", ctl.GetLoansController, admin)
+	eJWT.GET("/loans/overdue", ctl.GetOverdueLoansController, admin)
+	eJWT.GET("/loans/:id", ctl.GetLoanByIdController)
+	eJWT.POST("/loans/:id/return", ctl.ReturnLoanController)
 
 	return e
 }
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"users-books-api-testing/lib/database"
+	"users-books-api-testing/lib/openapi"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecCoversRoutes(t *testing.T) {
+	e := New(database.NewMemoryStore())
+	spec := Spec()
+
+	// groups with middleware catch everything under their prefix to answer
+	// 404 through it; those aren't API routes
+	notFound := runtime.FuncForPC(reflect.ValueOf(echo.NotFoundHandler).Pointer()).Name()
+
+	registered := map[string]bool{}
+	for _, route := range e.Routes() {
+		if route.Name == notFound {
+			continue
+		}
+		key := route.Method + " " + openapi.Path(route.Path)
+		registered[key] = true
+		assert.NotNil(t, spec.Operation(route.Method, route.Path), "%s is not in the OpenAPI document", key)
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			key := strings.ToUpper(method) + " " + path
+			assert.True(t, registered[key], "%s is documented but not registered in New", key)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	e := New(database.NewMemoryStore())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc)) {
+		assert.Equal(t, "3.0.3", doc.OpenAPI)
+		assert.Contains(t, doc.Paths, "/jwt/books/{id}")
+		assert.Contains(t, doc.Components.Schemas["User"].Properties, "email")
+		assert.NotContains(t, doc.Components.Schemas["User"].Properties, "password")
+		assert.NotContains(t, doc.Components.Schemas["User"].Properties, "token")
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/openapi.json")
+}
+
+func TestMetricsByRouteTemplate(t *testing.T) {
+	e := New(database.NewMemoryStore())
+
+	// rejected by the JWT middleware, which the metrics still see
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/jwt/books/42", nil))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/jwt/books/:id",status="400"}`)
+	assert.NotContains(t, body, "/jwt/books/42")
+	assert.Contains(t, body, "http_request_duration_seconds_bucket")
+}